@@ -29,6 +29,7 @@ import (
 	etcdRegistry "github.com/why444216978/gin-api/library/registry/etcd"
 	"github.com/why444216978/gin-api/library/servicer/service"
 	"github.com/why444216978/gin-api/server"
+	serverGRPC "github.com/why444216978/gin-api/server/grpc"
 )
 
 func Load() (err error) {
@@ -42,6 +43,9 @@ func Load() (err error) {
 	if err = loadClientHTTP(); err != nil {
 		return
 	}
+	if err = loadGRPC(); err != nil {
+		return
+	}
 	// TODO 避免用户第一次使用运行panic，留给用户自己打开需要的依赖
 	// if err = loadMysql("test_mysql"); err != nil {
 	// 	return
@@ -67,7 +71,7 @@ func Load() (err error) {
 	// if err = loadRegistry(); err != nil {
 	// 	return
 	// }
-	if err = service.LoadGlobPattern("services", "toml", resource.Etcd); err != nil {
+	if err = service.LoadGlobPattern("services", "toml", resource.Etcd, service.WithLogger(resource.ServiceLogger)); err != nil {
 		return
 	}
 
@@ -185,6 +189,18 @@ func loadJaeger() (err error) {
 	return
 }
 
+func loadGRPC() (err error) {
+	cfg := &serverGRPC.Config{}
+
+	if err = config.ReadConfig("grpc", "toml", cfg); err != nil {
+		return
+	}
+
+	resource.GRPCConfig = cfg
+
+	return
+}
+
 func loadEtcd() (err error) {
 	cfg := &etcd.Config{}
 
@@ -205,7 +221,7 @@ func loadEtcd() (err error) {
 func loadRegistry() (err error) {
 	var (
 		localIP string
-		cfg     = &registry.RegistryConfig{}
+		cfg     = &registry.RegistryConfig{Weight: registry.DefaultWeight}
 	)
 
 	if err = config.ReadConfig("registry", "toml", cfg); err != nil {
@@ -226,7 +242,9 @@ func loadRegistry() (err error) {
 		etcdRegistry.WithRegistrarServiceName(app.Name()),
 		etcdRegistry.WithRegistarHost(localIP),
 		etcdRegistry.WithRegistarPort(app.Port()),
-		etcdRegistry.WithRegistrarLease(cfg.Lease)); err != nil {
+		etcdRegistry.WithRegistrarLease(cfg.Lease),
+		etcdRegistry.WithRegistrarWeight(cfg.Weight),
+		etcdRegistry.WithRegistrarMeta(cfg.Meta)); err != nil {
 		return
 	}
 
@@ -77,6 +77,9 @@ func startHTTP(port int) {
 func startGRPC(port int) {
 	srv := serverH2C.NewH2C(fmt.Sprintf(":%d", port),
 		[]serverGRPC.Register{serviceGRPC.NewService()},
+		serverH2C.WithServerConfig(resource.GRPCConfig.Server),
+		serverH2C.WithClientConfig(resource.GRPCConfig.Client),
+		serverH2C.WithLogger(resource.ServiceLogger),
 	)
 
 	if err := bootstrap.NewApp(srv, resource.Registrar).Start(); err != nil {
@@ -7,6 +7,7 @@ import (
 
 	"github.com/why444216978/gin-api/app/response"
 	gin_api "github.com/why444216978/gin-api/app/rpc/gin-api"
+	httpClient "github.com/why444216978/gin-api/client/http"
 	httpResponse "github.com/why444216978/gin-api/server/http/response"
 	"github.com/why444216978/go-util/http"
 )
@@ -15,7 +16,7 @@ func Rpc(c *gin.Context) {
 	time.Sleep(time.Millisecond * 30)
 	ret, err := gin_api.RPC(c.Request.Context())
 	if err != nil {
-		response.ResponseJSON(c, response.CodeServer, ret, httpResponse.WrapToast(err, err.Error()))
+		response.ResponseJSON(c, rpcErrorCode(err), ret, httpResponse.WrapToast(err, err.Error()))
 		return
 	}
 
@@ -36,7 +37,7 @@ func Rpc1(c *gin.Context) {
 
 	ret, err := gin_api.RPC1(c.Request.Context())
 	if err != nil {
-		response.ResponseJSON(c, response.CodeServer, ret, httpResponse.WrapToast(err, err.Error()))
+		response.ResponseJSON(c, rpcErrorCode(err), ret, httpResponse.WrapToast(err, err.Error()))
 		return
 	}
 
@@ -46,3 +47,10 @@ func Rpc1(c *gin.Context) {
 func Panic(c *gin.Context) {
 	panic("test err")
 }
+
+func rpcErrorCode(err error) httpResponse.Code {
+	if httpClient.IsTimeout(err) {
+		return response.CodeTimeout
+	}
+	return response.CodeServer
+}
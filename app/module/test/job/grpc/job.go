@@ -7,8 +7,10 @@ import (
 	"time"
 
 	pb "github.com/why444216978/gin-api/app/module/test/service/grpc/helloworld"
+	"github.com/why444216978/gin-api/app/resource"
 	client "github.com/why444216978/gin-api/client/grpc"
 	"github.com/why444216978/gin-api/library/app"
+	serverGRPC "github.com/why444216978/gin-api/server/grpc"
 )
 
 func Start(ctx context.Context) (err error) {
@@ -17,7 +19,8 @@ func Start(ctx context.Context) (err error) {
 }
 
 func call() {
-	cc, err := client.Conn(context.Background(), fmt.Sprintf(":%d", app.Port()))
+	cc, err := client.Conn(context.Background(), fmt.Sprintf(":%d", app.Port()),
+		serverGRPC.DialOptionConfig(resource.GRPCConfig.Client))
 	if err != nil {
 		return
 	}
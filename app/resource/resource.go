@@ -11,6 +11,7 @@ import (
 	"github.com/why444216978/gin-api/library/orm"
 	"github.com/why444216978/gin-api/library/queue"
 	"github.com/why444216978/gin-api/library/registry"
+	serverGRPC "github.com/why444216978/gin-api/server/grpc"
 )
 
 var (
@@ -23,4 +24,5 @@ var (
 	RedisCache    cache.Cacher
 	Registrar     registry.Registrar
 	RabbitMQ      queue.Queue
+	GRPCConfig    *serverGRPC.Config
 )
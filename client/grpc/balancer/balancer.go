@@ -0,0 +1,120 @@
+package balancer
+
+import (
+	"sync/atomic"
+
+	"google.golang.org/grpc/attributes"
+	grpcBalancer "google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+
+	"github.com/why444216978/gin-api/library/selector"
+	"github.com/why444216978/gin-api/library/servicer"
+)
+
+// Name is the name of balancer which picks by servicer.Servicer
+const Name = "gin_api_servicer"
+
+// maxPickTimes is the max times to pick a node which is ready
+const maxPickTimes = 3
+
+type serviceNameKey struct{}
+
+func init() {
+	grpcBalancer.Register(base.NewBalancerBuilder(Name, &pickerBuilder{}, base.Config{}))
+}
+
+// WithServiceName sets the service name to the balancer attributes of address
+func WithServiceName(attrs *attributes.Attributes, serviceName string) *attributes.Attributes {
+	if attrs == nil {
+		return attributes.New(serviceNameKey{}, serviceName)
+	}
+	return attrs.WithValue(serviceNameKey{}, serviceName)
+}
+
+// ServiceName extracts the service name from the balancer attributes of address
+func ServiceName(addr resolver.Address) string {
+	name, _ := addr.BalancerAttributes.Value(serviceNameKey{}).(string)
+	return name
+}
+
+type pickerBuilder struct{}
+
+var _ base.PickerBuilder = (*pickerBuilder)(nil)
+
+func (*pickerBuilder) Build(info base.PickerBuildInfo) grpcBalancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(grpcBalancer.ErrNoSubConnAvailable)
+	}
+
+	p := &picker{
+		subConns:  make(map[string]grpcBalancer.SubConn, len(info.ReadySCs)),
+		addresses: make([]string, 0, len(info.ReadySCs)),
+	}
+	for sc, sci := range info.ReadySCs {
+		p.serviceName = ServiceName(sci.Address)
+		p.subConns[sci.Address.Addr] = sc
+		p.addresses = append(p.addresses, sci.Address.Addr)
+	}
+
+	return p
+}
+
+// picker picks the node by servicer.Servicer among the ready connections,
+// so that gRPC shares the selector, outlier ejection and statistics with HTTP transport.
+type picker struct {
+	serviceName string
+	subConns    map[string]grpcBalancer.SubConn
+	addresses   []string
+	next        uint32
+}
+
+var _ grpcBalancer.Picker = (*picker)(nil)
+
+func (p *picker) Pick(info grpcBalancer.PickInfo) (grpcBalancer.PickResult, error) {
+	service, ok := servicer.GetServicer(p.serviceName)
+	if !ok {
+		return grpcBalancer.PickResult{}, status.Errorf(codes.Unavailable, "service %s is nil", p.serviceName)
+	}
+
+	var node *servicer.Node
+	for i := 0; i < maxPickTimes; i++ {
+		n, err := service.Pick(info.Ctx)
+		if err != nil {
+			return grpcBalancer.PickResult{}, status.Error(codes.Unavailable, err.Error())
+		}
+		if _, ok := p.subConns[selector.GenerateAddress(n.Host, n.Port)]; ok {
+			node = n
+			break
+		}
+	}
+
+	// 选中的节点连接未就绪，轮询已就绪的连接
+	if node == nil {
+		i := atomic.AddUint32(&p.next, 1)
+		host, port := selector.ExtractAddress(p.addresses[int(i)%len(p.addresses)])
+		node = &servicer.Node{Host: host, Port: port}
+	}
+
+	ctx := info.Ctx
+	if starter, ok := service.(servicer.Starter); ok {
+		_ = starter.Start(ctx, node)
+	}
+	return grpcBalancer.PickResult{
+		SubConn: p.subConns[selector.GenerateAddress(node.Host, node.Port)],
+		Done: func(di grpcBalancer.DoneInfo) {
+			_ = service.Done(ctx, node, nodeError(di.Err))
+		},
+	}, nil
+}
+
+// nodeError returns err if it is the failure of node, the business errors are not
+func nodeError(err error) error {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.ResourceExhausted:
+		return err
+	}
+	return nil
+}
@@ -8,9 +8,14 @@ import (
 	serverGRPC "github.com/why444216978/gin-api/server/grpc"
 )
 
-func Conn(ctx context.Context, target string) (cc *grpc.ClientConn, err error) {
-	// TODO resolver
-	cc, err = grpc.DialContext(ctx, target, serverGRPC.NewDialOption()...)
+// Conn dials target, the target of resolver.Target(serviceName) is resolved and balanced by servicer
+func Conn(ctx context.Context, target string, opts ...serverGRPC.DialOptionFunc) (cc *grpc.ClientConn, err error) {
+	dialOptions, err := serverGRPC.NewDialOption(opts...)
+	if err != nil {
+		return
+	}
+
+	cc, err = grpc.DialContext(ctx, target, dialOptions...)
 	if err != nil {
 		return
 	}
@@ -0,0 +1,161 @@
+package resolver
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+
+	"github.com/why444216978/gin-api/client/grpc/balancer"
+	"github.com/why444216978/gin-api/library/selector"
+	"github.com/why444216978/gin-api/library/servicer"
+)
+
+// Scheme is the scheme of target resolved by servicer, such as gin-api:///service-name
+const Scheme = "gin-api"
+
+const defaultInterval = 5 * time.Second
+
+// Target returns the dial target of service
+func Target(serviceName string) string {
+	return fmt.Sprintf("%s:///%s", Scheme, serviceName)
+}
+
+type options struct {
+	interval time.Duration
+}
+
+type Option func(*options)
+
+// WithInterval sets the interval of refreshing nodes from servicer, default is 5 seconds
+func WithInterval(interval time.Duration) Option {
+	return func(o *options) { o.interval = interval }
+}
+
+type builder struct {
+	opts *options
+}
+
+var _ resolver.Builder = (*builder)(nil)
+
+// NewBuilder returns resolver.Builder which resolves addresses from servicer.Servicer,
+// the resolved connections are balanced by balancer.Name.
+func NewBuilder(opts ...Option) resolver.Builder {
+	opt := &options{interval: defaultInterval}
+	for _, o := range opts {
+		o(opt)
+	}
+	return &builder{opts: opt}
+}
+
+func (b *builder) Scheme() string {
+	return Scheme
+}
+
+func (b *builder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	serviceName := strings.TrimPrefix(target.URL.Path, "/")
+	if serviceName == "" {
+		serviceName = target.URL.Host
+	}
+	if serviceName == "" {
+		return nil, errors.New("service name is empty")
+	}
+
+	r := &servicerResolver{
+		serviceName: serviceName,
+		cc:          cc,
+		interval:    b.opts.interval,
+		serviceConfig: cc.ParseServiceConfig(
+			fmt.Sprintf(`{"loadBalancingConfig":[{"%s":{}}]}`, balancer.Name)),
+		resolveNow: make(chan struct{}, 1),
+		close:      make(chan struct{}),
+	}
+	if r.serviceConfig.Err != nil {
+		return nil, r.serviceConfig.Err
+	}
+
+	r.wg.Add(1)
+	go r.watch()
+
+	return r, nil
+}
+
+type servicerResolver struct {
+	serviceName   string
+	cc            resolver.ClientConn
+	interval      time.Duration
+	serviceConfig *serviceconfig.ParseResult
+	resolveNow    chan struct{}
+	close         chan struct{}
+	wg            sync.WaitGroup
+}
+
+var _ resolver.Resolver = (*servicerResolver)(nil)
+
+func (r *servicerResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.resolveNow <- struct{}{}:
+	default:
+	}
+}
+
+func (r *servicerResolver) Close() {
+	close(r.close)
+	r.wg.Wait()
+}
+
+// watch refreshes the nodes at interval or when ResolveNow is called until closed
+func (r *servicerResolver) watch() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	r.resolve()
+	for {
+		select {
+		case <-r.close:
+			return
+		case <-ticker.C:
+		case <-r.resolveNow:
+		}
+		r.resolve()
+	}
+}
+
+func (r *servicerResolver) resolve() {
+	service, ok := servicer.GetServicer(r.serviceName)
+	if !ok {
+		r.cc.ReportError(fmt.Errorf("service %s is nil", r.serviceName))
+		return
+	}
+
+	getter, ok := service.(servicer.NodeGetter)
+	if !ok {
+		r.cc.ReportError(fmt.Errorf("service %s can not list nodes", r.serviceName))
+		return
+	}
+
+	nodes, err := getter.GetNodes()
+	if err != nil {
+		r.cc.ReportError(err)
+		return
+	}
+
+	addrs := make([]resolver.Address, 0, len(nodes))
+	for _, n := range nodes {
+		addrs = append(addrs, resolver.Address{
+			Addr:               selector.GenerateAddress(n.Host, n.Port),
+			BalancerAttributes: balancer.WithServiceName(nil, r.serviceName),
+		})
+	}
+
+	_ = r.cc.UpdateState(resolver.State{
+		Addresses:     addrs,
+		ServiceConfig: r.serviceConfig,
+	})
+}
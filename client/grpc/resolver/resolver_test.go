@@ -0,0 +1,132 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/why444216978/gin-api/library/servicer"
+)
+
+type mockServicer struct {
+	name  string
+	lock  sync.Mutex
+	nodes []*servicer.Node
+	index uint32
+	done  map[int]int
+}
+
+var (
+	_ servicer.Servicer   = (*mockServicer)(nil)
+	_ servicer.NodeGetter = (*mockServicer)(nil)
+)
+
+func (s *mockServicer) Name() string { return s.name }
+
+func (s *mockServicer) Pick(ctx context.Context) (*servicer.Node, error) {
+	nodes, _ := s.GetNodes()
+	i := atomic.AddUint32(&s.index, 1)
+	return nodes[int(i)%len(nodes)], nil
+}
+
+func (s *mockServicer) Done(ctx context.Context, node *servicer.Node, err error) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.done[node.Port]++
+	return nil
+}
+
+func (s *mockServicer) GetCaCrt() []byte { return nil }
+
+func (s *mockServicer) GetClientPem() []byte { return nil }
+
+func (s *mockServicer) GetClientKey() []byte { return nil }
+
+func (s *mockServicer) GetNodes() ([]*servicer.Node, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.nodes, nil
+}
+
+func (s *mockServicer) setNodes(nodes []*servicer.Node) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.nodes = nodes
+}
+
+func (s *mockServicer) doneCount(port int) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.done[port]
+}
+
+func newServer(t *testing.T) (*grpc.Server, *servicer.Node) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	s := grpc.NewServer()
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go func() { _ = s.Serve(lis) }()
+
+	host, port, _ := net.SplitHostPort(lis.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return s, &servicer.Node{Host: host, Port: p}
+}
+
+func TestBuilder(t *testing.T) {
+	convey.Convey("TestBuilder", t, func() {
+		convey.Convey("resolve and balance by servicer", func() {
+			server1, node1 := newServer(t)
+			defer server1.Stop()
+			server2, node2 := newServer(t)
+			defer server2.Stop()
+
+			s := &mockServicer{name: "test_grpc", nodes: []*servicer.Node{node1}, done: map[int]int{}}
+			servicer.SetServicer(s)
+			defer servicer.DelServicer(s)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+			cc, err := grpc.DialContext(ctx, Target(s.name),
+				grpc.WithInsecure(),
+				grpc.WithBlock(),
+				grpc.WithResolvers(NewBuilder(WithInterval(time.Millisecond*10))))
+			assert.Nil(t, err)
+			defer cc.Close()
+
+			client := healthpb.NewHealthClient(cc)
+			check := func(times int) {
+				for i := 0; i < times; i++ {
+					_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+					assert.Nil(t, err)
+				}
+			}
+
+			check(4)
+			assert.Equal(t, 4, s.doneCount(node1.Port))
+
+			// the new node is resolved and picked by servicer
+			s.setNodes([]*servicer.Node{node1, node2})
+			assert.Eventually(t, func() bool {
+				check(2)
+				return s.doneCount(node2.Port) > 0
+			}, time.Second*3, time.Millisecond*20)
+		})
+		convey.Convey("empty service name", func() {
+			_, err := grpc.Dial(Scheme+":///",
+				grpc.WithInsecure(),
+				grpc.WithResolvers(NewBuilder()))
+			assert.NotNil(t, err)
+		})
+	})
+}
@@ -2,6 +2,9 @@ package http
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"time"
 
@@ -15,14 +18,126 @@ type Request struct {
 	Timeout time.Duration
 	Body    interface{}
 	Codec   codec.Codec
+	Hedge   *Hedge
+	// Cache caches the response of GET request when the transport has cacher
+	Cache *Cache
+	// AcceptStatus checks whether the HTTP code is success, DefaultAcceptStatus is used if nil
+	AcceptStatus func(code int) bool
+}
+
+// Hedge sends a second request to another node when the first one has not answered in time,
+// the first success wins and the other is canceled, it should only be used for read-only requests.
+type Hedge struct {
+	// Percentile is the latency percentile of service used as the hedge delay, such as 0.95
+	Percentile float64
+	// Delay is the hedge delay when Percentile is zero or there are not enough latency samples
+	Delay time.Duration
+}
+
+// Cache caches the accepted response, the stale response is returned and refreshed in background
+// after VirtualTTL, until it is evicted after TTL.
+type Cache struct {
+	// Headers are the request headers in the cache key besides service name and URI
+	Headers []string
+	// TTL is the ttl of cache storage
+	TTL time.Duration
+	// VirtualTTL is the ttl of fresh response, TTL is used when it is zero
+	VirtualTTL time.Duration
 }
 
 type Response struct {
 	HTTPCode int
+	Header   http.Header
 	Body     interface{}
 	Codec    codec.Codec
+	// ErrorBody is decoded by Codec when the HTTP code is not accepted
+	ErrorBody interface{}
+}
+
+// DefaultAcceptStatus accepts 2xx
+func DefaultAcceptStatus(code int) bool {
+	return code >= http.StatusOK && code < http.StatusMultipleChoices
+}
+
+// AcceptStatus accepts the given codes
+func AcceptStatus(codes ...int) func(code int) bool {
+	return func(code int) bool {
+		for _, c := range codes {
+			if c == code {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// StreamRequest is the request whose body is streamed, it is never retried or hedged
+type StreamRequest struct {
+	URI    string
+	Method string
+	Header http.Header
+	// Timeout is the deadline of the whole stream, including reading the response body
+	Timeout time.Duration
+	Body    io.Reader
+	// ContentLength is the length of Body, unknown length is sent chunked
+	ContentLength int64
+	// AcceptStatus checks whether the HTTP code is success, DefaultAcceptStatus is used if nil
+	AcceptStatus func(code int) bool
+}
+
+// StreamResponse is the response whose body is consumed by the caller,
+// Body must be closed, the request is accounted and logged when it is closed.
+type StreamResponse struct {
+	HTTPCode int
+	Header   http.Header
+	Body     io.ReadCloser
 }
 
 type Client interface {
 	Send(ctx context.Context, serviceName string, request Request, response *Response) (err error)
+	Stream(ctx context.Context, serviceName string, request StreamRequest) (response *StreamResponse, err error)
+}
+
+// TimeoutError is returned when the request exceeds Request.Timeout or the propagated timeout
+type TimeoutError struct {
+	Duration time.Duration
+	Err      error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("request timeout %s: %v", e.Duration, e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// IsTimeout checks whether err is *TimeoutError
+func IsTimeout(err error) bool {
+	var timeoutErr *TimeoutError
+	return errors.As(err, &timeoutErr)
+}
+
+// HTTPError is returned when the HTTP code is not accepted,
+// Body is the decoded Response.ErrorBody, Raw is the raw response body.
+type HTTPError struct {
+	Code   int
+	Header http.Header
+	Body   interface{}
+	Raw    []byte
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("http code is %d", e.Code)
+}
+
+// AsHTTPError returns *HTTPError if err is
+func AsHTTPError(err error) (*HTTPError, bool) {
+	var httpErr *HTTPError
+	ok := errors.As(err, &httpErr)
+	return httpErr, ok
 }
@@ -2,12 +2,117 @@ package http
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"sync/atomic"
 
 	jaeger "github.com/why444216978/gin-api/library/jaeger/http"
 	"github.com/why444216978/gin-api/library/logger"
 )
 
+// RoundTripperFunc adapts func to http.RoundTripper
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware wraps the next http.RoundTripper, it can abort by returning error without calling next,
+// retry by calling next more than once, or rewrite the request and response.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// AbortError is returned by the chain when a middleware fails the request without the error of rt,
+// such as a plugin or signing error, the node is not accounted and the request is never retried.
+type AbortError struct {
+	Err error
+}
+
+func (e *AbortError) Error() string {
+	return "request aborted: " + e.Err.Error()
+}
+
+func (e *AbortError) Unwrap() error {
+	return e.Err
+}
+
+// IsAbort checks whether err is *AbortError, *url.Error returned by http.Client is unwrapped
+func IsAbort(err error) bool {
+	var abortErr *AbortError
+	return errors.As(err, &abortErr)
+}
+
+type transportFailedKey struct{}
+
+// Chain wraps rt with middlewares, the first middleware is the outermost.
+// The error not returned by the last call of rt is wrapped as *AbortError.
+func Chain(rt http.RoundTripper, middlewares ...Middleware) http.RoundTripper {
+	next := RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := rt.RoundTrip(req)
+		if failed, ok := req.Context().Value(transportFailedKey{}).(*int32); ok {
+			var v int32
+			if err != nil {
+				v = 1
+			}
+			atomic.StoreInt32(failed, v)
+		}
+		return resp, err
+	})
+
+	var chain http.RoundTripper = next
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		chain = middlewares[i](chain)
+	}
+
+	return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		failed := new(int32)
+		req = req.WithContext(context.WithValue(req.Context(), transportFailedKey{}, failed))
+		resp, err := chain.RoundTrip(req)
+		if err != nil && atomic.LoadInt32(failed) == 0 && !IsAbort(err) {
+			err = &AbortError{Err: err}
+		}
+		return resp, err
+	})
+}
+
+// BeforePluginMiddleware adapts BeforeRequestPlugin to Middleware, the request is aborted when a plugin returns error
+func BeforePluginMiddleware(plugins ...BeforeRequestPlugin) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			for _, plugin := range plugins {
+				if err := plugin.Handle(req.Context(), req); err != nil {
+					return nil, err
+				}
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// AfterPluginMiddleware adapts AfterRequestPlugin to Middleware, resp is nil when the request failed.
+// The response is closed and the error is returned when a plugin returns error.
+func AfterPluginMiddleware(plugins ...AfterRequestPlugin) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.RoundTrip(req)
+			for _, plugin := range plugins {
+				perr := plugin.Handle(req.Context(), req, resp)
+				if perr == nil {
+					continue
+				}
+				// 请求本身失败时优先返回请求的错误
+				if err != nil {
+					return nil, err
+				}
+				if resp != nil && resp.Body != nil {
+					resp.Body.Close()
+				}
+				return nil, perr
+			}
+			return resp, err
+		})
+	}
+}
+
 type BeforeRequestPlugin interface {
 	Handle(ctx context.Context, req *http.Request) error
 }
@@ -23,5 +128,9 @@ var _ BeforeRequestPlugin = (*JaegerBeforePlugin)(nil)
 func (*JaegerBeforePlugin) Handle(ctx context.Context, req *http.Request) error {
 	logID := logger.ValueLogID(ctx)
 	req.Header.Add(logger.LogHeader, logID)
-	return jaeger.InjectHTTP(ctx, req, logID)
+	// 未开启jaeger时不中断请求
+	if err := jaeger.InjectHTTP(ctx, req, logID); err != nil && !errors.Is(err, jaeger.ErrTracerNil) {
+		return err
+	}
+	return nil
 }
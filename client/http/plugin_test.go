@@ -0,0 +1,156 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestResponse(code int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: code,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}
+}
+
+type testBeforePlugin struct{ calls *[]string }
+
+func (p *testBeforePlugin) Handle(ctx context.Context, req *http.Request) error {
+	*p.calls = append(*p.calls, "before")
+	return assert.AnError
+}
+
+type testBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *testBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+type testAfterPlugin struct{ calls *[]string }
+
+func (p *testAfterPlugin) Handle(ctx context.Context, req *http.Request, resp *http.Response) error {
+	*p.calls = append(*p.calls, "after")
+	return assert.AnError
+}
+
+func TestChain(t *testing.T) {
+	convey.Convey("TestChain", t, func() {
+		req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/test", nil)
+
+		convey.Convey("order", func() {
+			calls := []string{}
+			mark := func(name string) Middleware {
+				return func(next http.RoundTripper) http.RoundTripper {
+					return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+						calls = append(calls, name)
+						return next.RoundTrip(req)
+					})
+				}
+			}
+			rt := Chain(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				calls = append(calls, "transport")
+				return newTestResponse(http.StatusOK, ""), nil
+			}), mark("a"), mark("b"))
+
+			_, err := rt.RoundTrip(req)
+			assert.Nil(t, err)
+			assert.Equal(t, []string{"a", "b", "transport"}, calls)
+		})
+		convey.Convey("abort", func() {
+			abort := func(next http.RoundTripper) http.RoundTripper {
+				return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					return nil, assert.AnError
+				})
+			}
+			rt := Chain(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				t.Fatal("should not be called")
+				return nil, nil
+			}), abort)
+
+			_, err := rt.RoundTrip(req)
+			assert.ErrorIs(t, err, assert.AnError)
+			assert.Equal(t, true, IsAbort(err))
+		})
+		convey.Convey("retry and rewrite", func() {
+			times := 0
+			retry := func(next http.RoundTripper) http.RoundTripper {
+				return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					resp, err := next.RoundTrip(req)
+					if err != nil {
+						resp, err = next.RoundTrip(req)
+					}
+					if err == nil {
+						resp.Header.Set("X-Rewrite", "1")
+					}
+					return resp, err
+				})
+			}
+			rt := Chain(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				times++
+				if times == 1 {
+					return nil, assert.AnError
+				}
+				return newTestResponse(http.StatusOK, ""), nil
+			}), retry)
+
+			resp, err := rt.RoundTrip(req)
+			assert.Nil(t, err)
+			assert.Equal(t, 2, times)
+			assert.Equal(t, "1", resp.Header.Get("X-Rewrite"))
+		})
+		convey.Convey("before plugin error aborts the request", func() {
+			calls := []string{}
+			rt := Chain(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				calls = append(calls, "transport")
+				return newTestResponse(http.StatusOK, ""), nil
+			}),
+				BeforePluginMiddleware(&testBeforePlugin{calls: &calls}),
+				AfterPluginMiddleware(&testAfterPlugin{calls: &calls}))
+
+			resp, err := rt.RoundTrip(req)
+			assert.ErrorIs(t, err, assert.AnError)
+			assert.Equal(t, true, IsAbort(err))
+			assert.Nil(t, resp)
+			assert.Equal(t, []string{"before"}, calls)
+		})
+		convey.Convey("after plugin error closes the response", func() {
+			calls := []string{}
+			body := &testBody{Reader: strings.NewReader("body")}
+			rt := Chain(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				calls = append(calls, "transport")
+				return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: body}, nil
+			}), AfterPluginMiddleware(&testAfterPlugin{calls: &calls}))
+
+			resp, err := rt.RoundTrip(req)
+			assert.ErrorIs(t, err, assert.AnError)
+			assert.Equal(t, true, IsAbort(err))
+			assert.Nil(t, resp)
+			assert.Equal(t, true, body.closed)
+			assert.Equal(t, []string{"transport", "after"}, calls)
+		})
+		convey.Convey("request error is kept", func() {
+			calls := []string{}
+			errTransport := errors.New("transport")
+			rt := Chain(RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				return nil, errTransport
+			}), AfterPluginMiddleware(&testAfterPlugin{calls: &calls}))
+
+			_, err := rt.RoundTrip(req)
+			assert.Equal(t, errTransport, err)
+			assert.Equal(t, false, IsAbort(err))
+			assert.Equal(t, []string{"after"}, calls)
+		})
+	})
+}
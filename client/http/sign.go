@@ -0,0 +1,21 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/why444216978/gin-api/library/signature"
+)
+
+// SignMiddleware signs the method, path, body hash, timestamp and nonce of request with HMAC,
+// the streaming body is not buffered and signed as signature.UnsignedPayload.
+func SignMiddleware(cfg signature.Config) Middleware {
+	secret := []byte(cfg.Secret)
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if err := signature.SignRequest(req, cfg.KeyID, secret); err != nil {
+				return nil, err
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	client "github.com/why444216978/gin-api/client/http"
+	"github.com/why444216978/gin-api/library/logger"
+	"github.com/why444216978/gin-api/library/servicer"
+)
+
+const (
+	cacheKeyPrefix = "rpc_cache::"
+
+	cacheHit  = "hit"
+	cacheMiss = "miss"
+	cacheFail = "fail"
+)
+
+// errNotAccepted stops caching the response whose HTTP code is not accepted
+var errNotAccepted = errors.New("response is not accepted")
+
+// cachedResponse is the response saved in cache
+type cachedResponse struct {
+	HTTPCode int
+	Header   http.Header
+	Body     []byte
+}
+
+func (c *cachedResponse) response() *http.Response {
+	return &http.Response{
+		StatusCode: c.HTTPCode,
+		Header:     c.Header,
+		Body:       ioutil.NopCloser(bytes.NewReader(c.Body)),
+	}
+}
+
+// cacheKey is derived from service name, URI and the selected headers
+func cacheKey(serviceName string, request client.Request) string {
+	b := strings.Builder{}
+	b.WriteString(cacheKeyPrefix)
+	b.WriteString(serviceName)
+	b.WriteString("::")
+	b.WriteString(request.URI)
+	for _, h := range request.Cache.Headers {
+		b.WriteString("::")
+		b.WriteString(http.CanonicalHeaderKey(h))
+		b.WriteString("=")
+		b.WriteString(strings.Join(request.Header.Values(h), ","))
+	}
+	return b.String()
+}
+
+// sendCache gets the response from cacher, the request is sent when it is missed,
+// the cacher failure falls back to sending request directly.
+func (r *RPC) sendCache(ctx context.Context, serviceName string, service servicer.Servicer, request client.Request, body []byte, response *client.Response) (
+	node *servicer.Node, status string, err error) {
+	ttl := request.Cache.TTL
+	if ttl <= 0 {
+		return nil, "", errors.New("request.Cache.TTL must be positive")
+	}
+	virtualTTL := request.Cache.VirtualTTL
+	if virtualTTL <= 0 {
+		virtualTTL = ttl
+	}
+
+	var (
+		entry   = &cachedResponse{}
+		loaded  bool
+		loadErr error
+	)
+	load := func(ctx context.Context, target interface{}) (err error) {
+		data, ok := target.(*cachedResponse)
+		if !ok {
+			return errors.New("cache target is not *cachedResponse")
+		}
+		// 仅记录同步加载的结果，后台刷新使用新的target
+		defer func() {
+			if data == entry {
+				loaded = true
+				loadErr = err
+			}
+		}()
+
+		// 后台刷新同样受请求超时控制
+		ctx, cancelTimeout, _, err := withTimeout(ctx, request.Timeout)
+		if err != nil {
+			return err
+		}
+		defer cancelTimeout()
+
+		n, resp, cancel, err := r.roundTrip(ctx, serviceName, service, request, body)
+		defer cancel()
+		if data == entry {
+			node = n
+		}
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		data.HTTPCode = resp.StatusCode
+		data.Header = resp.Header
+		data.Body = b
+
+		accept := request.AcceptStatus
+		if accept == nil {
+			accept = client.DefaultAcceptStatus
+		}
+		if !accept(resp.StatusCode) {
+			return errNotAccepted
+		}
+		return nil
+	}
+
+	err = r.cacher.GetData(ctx, cacheKey(serviceName, request), ttl, virtualTTL, load, entry)
+	switch {
+	case loaded:
+		// 加载成功但写缓存失败不影响本次响应
+		status = cacheMiss
+		if err != nil && err != loadErr {
+			r.logCacheFail(ctx, serviceName, request, err)
+		}
+		err = loadErr
+	case err != nil:
+		// 缓存故障降级为直接请求
+		status = cacheFail
+		r.logCacheFail(ctx, serviceName, request, err)
+		err = load(ctx, entry)
+	default:
+		status = cacheHit
+	}
+	if err != nil && !errors.Is(err, errNotAccepted) {
+		return
+	}
+
+	err = decodeResponse(request, response, entry.response())
+
+	return
+}
+
+func (r *RPC) logCacheFail(ctx context.Context, serviceName string, request client.Request, err error) {
+	if r.logger == nil {
+		return
+	}
+	r.logger.Warn(ctx, "rpc cache fail: "+err.Error(),
+		logger.Reflect(logger.ServiceName, serviceName),
+		logger.Reflect(logger.API, request.URI),
+	)
+}
@@ -0,0 +1,134 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+	jsonCodec "github.com/why444216978/codec/json"
+
+	client "github.com/why444216978/gin-api/client/http"
+	"github.com/why444216978/gin-api/library/cache"
+	"github.com/why444216978/gin-api/library/servicer"
+)
+
+type mockCacher struct {
+	data map[string][]byte
+	err  error
+}
+
+var _ cache.Cacher = (*mockCacher)(nil)
+
+func (c *mockCacher) GetData(ctx context.Context, key string, ttl time.Duration, virtualTTL time.Duration, f cache.LoadFunc, data interface{}) error {
+	if c.err != nil {
+		return c.err
+	}
+	if b, ok := c.data[key]; ok {
+		return json.Unmarshal(b, data)
+	}
+	return c.FlushCache(ctx, key, ttl, virtualTTL, f, data)
+}
+
+func (c *mockCacher) FlushCache(ctx context.Context, key string, ttl time.Duration, virtualTTL time.Duration, f cache.LoadFunc, data interface{}) error {
+	if err := cache.HandleLoad(ctx, f, data); err != nil {
+		return err
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	c.data[key] = b
+	return nil
+}
+
+func TestRPC_SendCache(t *testing.T) {
+	convey.Convey("TestRPC_SendCache", t, func() {
+		var count int32
+		code := int32(http.StatusOK)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&count, 1)
+			w.WriteHeader(int(atomic.LoadInt32(&code)))
+			_, _ = w.Write([]byte(`{"count":` + r.Header.Get("Count") + `}`))
+		}))
+		defer server.Close()
+
+		s := &mockServicer{name: "test_cache", nodes: []*servicer.Node{newNode(t, server)}}
+		servicer.SetServicer(s)
+		defer servicer.DelServicer(s)
+
+		request := func(header string) client.Request {
+			return client.Request{
+				URI:    "/test",
+				Method: http.MethodGet,
+				Header: http.Header{"Count": []string{header}},
+				Codec:  jsonCodec.JSONCodec{},
+				Cache:  &client.Cache{Headers: []string{"count"}, TTL: time.Minute},
+			}
+		}
+		send := func(rpc *RPC, request client.Request) (string, map[string]interface{}, error) {
+			body := map[string]interface{}{}
+			response := &client.Response{Body: &body, Codec: jsonCodec.JSONCodec{}}
+			_, status, err := rpc.sendCache(context.Background(), s.name, s, request, nil, response)
+			return status, body, err
+		}
+
+		convey.Convey("miss and hit", func() {
+			atomic.StoreInt32(&count, 0)
+			rpc := New(WithCacher(&mockCacher{data: map[string][]byte{}}))
+
+			status, body, err := send(rpc, request("1"))
+			assert.Nil(t, err)
+			assert.Equal(t, cacheMiss, status)
+			assert.Equal(t, float64(1), body["count"])
+
+			status, body, err = send(rpc, request("1"))
+			assert.Nil(t, err)
+			assert.Equal(t, cacheHit, status)
+			assert.Equal(t, float64(1), body["count"])
+
+			status, _, err = send(rpc, request("2"))
+			assert.Nil(t, err)
+			assert.Equal(t, cacheMiss, status)
+			assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+
+			err = rpc.Send(context.Background(), s.name, request("2"), &client.Response{Body: &map[string]interface{}{}, Codec: jsonCodec.JSONCodec{}})
+			assert.Nil(t, err)
+			assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+		})
+		convey.Convey("not accepted is not cached", func() {
+			atomic.StoreInt32(&count, 0)
+			atomic.StoreInt32(&code, http.StatusNotFound)
+			defer atomic.StoreInt32(&code, http.StatusOK)
+			rpc := New(WithCacher(&mockCacher{data: map[string][]byte{}}))
+
+			for i := 0; i < 2; i++ {
+				status, _, err := send(rpc, request("1"))
+				httpErr, ok := client.AsHTTPError(err)
+				assert.Equal(t, true, ok)
+				assert.Equal(t, http.StatusNotFound, httpErr.Code)
+				assert.Equal(t, cacheMiss, status)
+			}
+			assert.Equal(t, int32(2), atomic.LoadInt32(&count))
+		})
+		convey.Convey("cacher fail falls back", func() {
+			rpc := New(WithCacher(&mockCacher{err: assert.AnError}))
+			status, body, err := send(rpc, request("1"))
+			assert.Nil(t, err)
+			assert.Equal(t, cacheFail, status)
+			assert.Equal(t, float64(1), body["count"])
+		})
+		convey.Convey("invalid ttl", func() {
+			rpc := New(WithCacher(&mockCacher{data: map[string][]byte{}}))
+			req := request("1")
+			req.Cache.TTL = 0
+			_, _, err := send(rpc, req)
+			assert.NotNil(t, err)
+		})
+	})
+}
@@ -0,0 +1,166 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	client "github.com/why444216978/gin-api/client/http"
+	"github.com/why444216978/gin-api/library/servicer"
+)
+
+const (
+	// latencyWindow is the count of latest latency samples of a service
+	latencyWindow = 128
+	// minLatencySamples is the min samples to calculate percentile
+	minLatencySamples = 20
+)
+
+// latency keeps the latest latency samples of a service
+type latency struct {
+	lock    sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+func (l *latency) record(d time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if len(l.samples) < latencyWindow {
+		l.samples = append(l.samples, d)
+		return
+	}
+	l.samples[l.next] = d
+	l.next = (l.next + 1) % latencyWindow
+}
+
+// percentile returns the p percentile of samples, false is returned when samples are not enough
+func (l *latency) percentile(p float64) (time.Duration, bool) {
+	l.lock.Lock()
+	samples := make([]time.Duration, len(l.samples))
+	copy(samples, l.samples)
+	l.lock.Unlock()
+
+	if len(samples) < minLatencySamples {
+		return 0, false
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+	idx := int(float64(len(samples))*p+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(samples) {
+		idx = len(samples) - 1
+	}
+	return samples[idx], true
+}
+
+func (r *RPC) getLatency(serviceName string) *latency {
+	l, ok := r.latencies.Load(serviceName)
+	if !ok {
+		l, _ = r.latencies.LoadOrStore(serviceName, &latency{})
+	}
+	return l.(*latency)
+}
+
+// hedgeDelay returns the delay before sending the hedged request, false is returned when no hedging
+func (r *RPC) hedgeDelay(serviceName string, hedge *client.Hedge) (time.Duration, bool) {
+	if hedge == nil {
+		return 0, false
+	}
+
+	if hedge.Percentile > 0 && hedge.Percentile <= 1 {
+		if d, ok := r.getLatency(serviceName).percentile(hedge.Percentile); ok {
+			return d, true
+		}
+	}
+
+	return hedge.Delay, hedge.Delay > 0
+}
+
+type hedgeResult struct {
+	index int
+	node  *servicer.Node
+	resp  *http.Response
+	err   error
+}
+
+func (res *hedgeResult) success() bool {
+	return res.err == nil && res.resp.StatusCode < http.StatusInternalServerError
+}
+
+// hedge sends the request, and sends a second one to another node if the first one has not answered in delay,
+// the first success wins and the other is canceled.
+func (r *RPC) hedge(ctx context.Context, serviceName string, service servicer.Servicer, request client.Request, body []byte, tried map[string]struct{}, delay time.Duration) (node *servicer.Node, resp *http.Response, cancel context.CancelFunc, err error) {
+	var (
+		results  = make(chan *hedgeResult, 2)
+		cancels  = make([]context.CancelFunc, 0, 2)
+		inflight = 0
+	)
+
+	send := func(node *servicer.Node) {
+		attemptCtx, attemptCancel := context.WithCancel(ctx)
+		index := len(cancels)
+		cancels = append(cancels, attemptCancel)
+		inflight++
+
+		go func() {
+			resp, err := r.attempt(attemptCtx, ctx, serviceName, service, request, body, node)
+			results <- &hedgeResult{index: index, node: node, resp: resp, err: err}
+		}()
+	}
+
+	if node, err = pickNode(ctx, service, tried); err != nil {
+		return node, nil, func() {}, err
+	}
+	send(node)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			hedgeNode, pickErr := pickNode(ctx, service, tried)
+			if pickErr != nil {
+				continue
+			}
+			send(hedgeNode)
+		case res := <-results:
+			inflight--
+			if !res.success() && inflight > 0 {
+				discard(res)
+				cancels[res.index]()
+				continue
+			}
+
+			// 取消其它请求
+			for i, c := range cancels {
+				if i != res.index {
+					c()
+				}
+			}
+			go drain(results, inflight)
+
+			return res.node, res.resp, cancels[res.index], res.err
+		}
+	}
+}
+
+// drain discards the results of canceled requests
+func drain(results chan *hedgeResult, count int) {
+	for i := 0; i < count; i++ {
+		discard(<-results)
+	}
+}
+
+func discard(res *hedgeResult) {
+	if res.resp != nil {
+		res.resp.Body.Close()
+	}
+}
@@ -0,0 +1,131 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+	"github.com/why444216978/codec/json"
+
+	client "github.com/why444216978/gin-api/client/http"
+	"github.com/why444216978/gin-api/library/selector"
+	"github.com/why444216978/gin-api/library/servicer"
+)
+
+func TestLatency_percentile(t *testing.T) {
+	convey.Convey("TestLatency_percentile", t, func() {
+		convey.Convey("not enough samples", func() {
+			l := &latency{}
+			l.record(time.Millisecond)
+			_, ok := l.percentile(0.9)
+			assert.Equal(t, false, ok)
+		})
+		convey.Convey("success", func() {
+			l := &latency{}
+			for i := 1; i <= latencyWindow+100; i++ {
+				l.record(time.Duration(i) * time.Millisecond)
+			}
+			d, ok := l.percentile(0.5)
+			assert.Equal(t, true, ok)
+			assert.Equal(t, time.Duration(100+latencyWindow/2)*time.Millisecond, d)
+
+			d, _ = l.percentile(1)
+			assert.Equal(t, time.Duration(100+latencyWindow)*time.Millisecond, d)
+		})
+	})
+}
+
+func TestRPC_hedgeDelay(t *testing.T) {
+	convey.Convey("TestRPC_hedgeDelay", t, func() {
+		convey.Convey("no hedge", func() {
+			_, ok := New().hedgeDelay("test_service", nil)
+			assert.Equal(t, false, ok)
+			_, ok = New().hedgeDelay("test_service", &client.Hedge{Percentile: 0.9})
+			assert.Equal(t, false, ok)
+		})
+		convey.Convey("fixed delay before enough samples", func() {
+			d, ok := New().hedgeDelay("test_service", &client.Hedge{Percentile: 0.9, Delay: time.Millisecond})
+			assert.Equal(t, true, ok)
+			assert.Equal(t, time.Millisecond, d)
+		})
+		convey.Convey("percentile delay", func() {
+			r := New()
+			for i := 0; i < minLatencySamples; i++ {
+				r.getLatency("test_service").record(time.Second)
+			}
+			d, ok := r.hedgeDelay("test_service", &client.Hedge{Percentile: 0.9, Delay: time.Millisecond})
+			assert.Equal(t, true, ok)
+			assert.Equal(t, time.Second, d)
+		})
+	})
+}
+
+func TestRPC_hedge(t *testing.T) {
+	convey.Convey("TestRPC_hedge", t, func() {
+		var slowCanceled, fastCount int32
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// the request body must be read to detect the canceled connection
+			_, _ = io.Copy(io.Discard, r.Body)
+			select {
+			case <-r.Context().Done():
+				atomic.AddInt32(&slowCanceled, 1)
+			case <-time.After(time.Second):
+			}
+		}))
+		defer slow.Close()
+		fast := newServer(http.StatusOK, &fastCount)
+		defer fast.Close()
+
+		convey.Convey("fast node wins", func() {
+			s := &doneServicer{mockServicer: mockServicer{
+				name:  "test_hedge",
+				nodes: []*servicer.Node{newNode(t, slow), newNode(t, fast)},
+			}}
+			servicer.SetServicer(s)
+			defer servicer.DelServicer(s)
+
+			start := time.Now()
+			response := client.Response{Body: &map[string]interface{}{}, Codec: json.JSONCodec{}}
+			err := New().Send(context.Background(), s.name, client.Request{
+				URI:    "/test",
+				Method: http.MethodGet,
+				Codec:  json.JSONCodec{},
+				Hedge:  &client.Hedge{Delay: time.Millisecond * 20},
+			}, &response)
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusOK, response.HTTPCode)
+			assert.Less(t, int64(time.Since(start)), int64(time.Millisecond*500))
+			assert.Equal(t, int32(1), atomic.LoadInt32(&fastCount))
+
+			// both attempts are accounted, the canceled one is neither success nor failure
+			assert.Eventually(t, func() bool { return atomic.LoadInt32(&s.done) == 2 }, time.Second, time.Millisecond*10)
+			assert.Equal(t, int32(0), atomic.LoadInt32(&s.fail))
+			assert.Equal(t, int32(1), atomic.LoadInt32(&s.canceled))
+			assert.Eventually(t, func() bool { return atomic.LoadInt32(&slowCanceled) == 1 }, time.Second, time.Millisecond*10)
+		})
+	})
+}
+
+type doneServicer struct {
+	mockServicer
+	done     int32
+	fail     int32
+	canceled int32
+}
+
+func (s *doneServicer) Done(ctx context.Context, node *servicer.Node, err error) error {
+	atomic.AddInt32(&s.done, 1)
+	switch {
+	case selector.IsCanceled(err):
+		atomic.AddInt32(&s.canceled, 1)
+	case err != nil:
+		atomic.AddInt32(&s.fail, 1)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package transport
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	client "github.com/why444216978/gin-api/client/http"
+	"github.com/why444216978/gin-api/library/selector"
+	"github.com/why444216978/gin-api/library/servicer"
+)
+
+const (
+	defaultMaxIdleConns                   = 30
+	defaultIdleConnTimeoutSecond          = 60
+	defaultDialTimeoutMillisecond         = 3000
+	defaultKeepAliveSecond                = 60
+	defaultTLSHandshakeTimeoutMillisecond = 3000
+
+	// cleanInterval is the min interval of evicting the clients of disappeared nodes
+	cleanInterval = 10 * time.Second
+)
+
+// pool keeps the long-lived client of every node of a service
+type pool struct {
+	lock    sync.Mutex
+	clients map[string]*http.Client
+	cleanAt time.Time
+}
+
+// getClient returns the cached client of node, the clients of disappeared nodes are evicted
+func (r *RPC) getClient(serviceName string, service servicer.Servicer, node *servicer.Node) *http.Client {
+	p := r.getPool(serviceName)
+	p.clean(service)
+
+	address := selector.GenerateAddress(node.Host, node.Port)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if client, ok := p.clients[address]; ok {
+		return client
+	}
+
+	client := r.newClient(service)
+	p.clients[address] = client
+
+	return client
+}
+
+func (r *RPC) getPool(serviceName string) *pool {
+	p, ok := r.pools.Load(serviceName)
+	if !ok {
+		p, _ = r.pools.LoadOrStore(serviceName, &pool{
+			clients: make(map[string]*http.Client),
+			cleanAt: time.Now().Add(cleanInterval),
+		})
+	}
+	return p.(*pool)
+}
+
+// clean evicts the clients of nodes which not exist, it runs at most once in cleanInterval
+func (p *pool) clean(service servicer.Servicer) {
+	now := time.Now()
+
+	p.lock.Lock()
+	if now.Before(p.cleanAt) {
+		p.lock.Unlock()
+		return
+	}
+	p.cleanAt = now.Add(cleanInterval)
+	p.lock.Unlock()
+
+	getter, ok := service.(servicer.NodeGetter)
+	if !ok {
+		return
+	}
+	nodes, err := getter.GetNodes()
+	if err != nil {
+		return
+	}
+
+	exists := make(map[string]struct{}, len(nodes))
+	for _, n := range nodes {
+		exists[selector.GenerateAddress(n.Host, n.Port)] = struct{}{}
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for address, client := range p.clients {
+		if _, ok := exists[address]; ok {
+			continue
+		}
+		client.CloseIdleConnections()
+		delete(p.clients, address)
+	}
+}
+
+func (r *RPC) newClient(service servicer.Servicer) *http.Client {
+	cfg := serviceTransportConfig(service)
+
+	maxIdleConns := cfg.MaxIdleConns
+	if maxIdleConns <= 0 {
+		maxIdleConns = defaultMaxIdleConns
+	}
+	idleConnTimeout := time.Duration(cfg.IdleConnTimeoutSecond) * time.Second
+	if idleConnTimeout <= 0 {
+		idleConnTimeout = defaultIdleConnTimeoutSecond * time.Second
+	}
+	dialTimeout := time.Duration(cfg.DialTimeoutMillisecond) * time.Millisecond
+	if dialTimeout <= 0 {
+		dialTimeout = defaultDialTimeoutMillisecond * time.Millisecond
+	}
+	keepAlive := time.Duration(cfg.KeepAliveSecond) * time.Second
+	if keepAlive <= 0 {
+		keepAlive = defaultKeepAliveSecond * time.Second
+	}
+	tlsHandshakeTimeout := time.Duration(cfg.TLSHandshakeTimeoutMillisecond) * time.Millisecond
+	if tlsHandshakeTimeout <= 0 {
+		tlsHandshakeTimeout = defaultTLSHandshakeTimeoutMillisecond * time.Millisecond
+	}
+
+	tp := &http.Transport{
+		MaxIdleConns:        maxIdleConns,
+		MaxIdleConnsPerHost: maxIdleConns,
+		MaxConnsPerHost:     cfg.MaxConns,
+		IdleConnTimeout:     idleConnTimeout,
+		TLSHandshakeTimeout: tlsHandshakeTimeout,
+		TLSClientConfig:     serviceTLSConfig(service),
+		DialContext: (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: keepAlive,
+		}).DialContext,
+	}
+
+	return &http.Client{Transport: r.wrap(service, tp)}
+}
+
+// wrap wraps rt with the plugins and middlewares, the signing is the innermost to cover the rewrites of middlewares
+func (r *RPC) wrap(service servicer.Servicer, rt http.RoundTripper) http.RoundTripper {
+	middlewares := make([]client.Middleware, 0, len(r.middlewares)+3)
+	middlewares = append(middlewares, client.BeforePluginMiddleware(r.beforePlugins...))
+	middlewares = append(middlewares, r.middlewares...)
+	middlewares = append(middlewares, client.AfterPluginMiddleware(r.afterPlugins...))
+	if cfg := serviceSignConfig(service); cfg.Enabled() {
+		middlewares = append(middlewares, client.SignMiddleware(cfg))
+	}
+
+	return client.Chain(rt, middlewares...)
+}
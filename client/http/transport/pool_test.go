@@ -0,0 +1,83 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+	"github.com/why444216978/codec/json"
+
+	client "github.com/why444216978/gin-api/client/http"
+
+	"github.com/why444216978/gin-api/library/servicer"
+)
+
+func TestRPC_getClient(t *testing.T) {
+	convey.Convey("TestRPC_getClient", t, func() {
+		convey.Convey("reuse client", func() {
+			s := &mockServicer{
+				name:  "test_pool",
+				nodes: []*servicer.Node{{Host: "127.0.0.1", Port: 80}, {Host: "127.0.0.2", Port: 80}},
+			}
+			r := New()
+
+			c1 := r.getClient(s.name, s, s.nodes[0])
+			c2 := r.getClient(s.name, s, s.nodes[0])
+			assert.Same(t, c1, c2)
+
+			c3 := r.getClient(s.name, s, s.nodes[1])
+			assert.NotSame(t, c1, c3)
+		})
+		convey.Convey("evict disappeared node", func() {
+			s := &mockServicer{
+				name:  "test_pool_evict",
+				nodes: []*servicer.Node{{Host: "127.0.0.1", Port: 80}, {Host: "127.0.0.2", Port: 80}},
+			}
+			r := New()
+
+			_ = r.getClient(s.name, s, s.nodes[0])
+			_ = r.getClient(s.name, s, s.nodes[1])
+			p := r.getPool(s.name)
+			assert.Len(t, p.clients, 2)
+
+			s.nodes = s.nodes[:1]
+			p.cleanAt = time.Now()
+			_ = r.getClient(s.name, s, s.nodes[0])
+			assert.Len(t, p.clients, 1)
+			_, ok := p.clients["127.0.0.1:80"]
+			assert.Equal(t, true, ok)
+		})
+		convey.Convey("https", func() {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(`{}`))
+			}))
+			defer server.Close()
+
+			s := &tlsServicer{mockServicer{name: "test_pool_tls", nodes: []*servicer.Node{newNode(t, server)}}}
+			servicer.SetServicer(s)
+			defer servicer.DelServicer(s)
+
+			response := &client.Response{Body: &map[string]interface{}{}, Codec: json.JSONCodec{}}
+			err := New().Send(context.Background(), s.name, client.Request{
+				URI:    "/test",
+				Method: http.MethodGet,
+				Codec:  json.JSONCodec{},
+			}, response)
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusOK, response.HTTPCode)
+		})
+	})
+}
+
+type tlsServicer struct {
+	mockServicer
+}
+
+var testTLSConfig = &tls.Config{InsecureSkipVerify: true}
+
+func (s *tlsServicer) GetTLSConfig() *tls.Config { return testTLSConfig }
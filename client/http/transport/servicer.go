@@ -0,0 +1,72 @@
+package transport
+
+import (
+	"crypto/tls"
+
+	"github.com/why444216978/gin-api/library/breaker"
+	"github.com/why444216978/gin-api/library/retry"
+	"github.com/why444216978/gin-api/library/servicer"
+	"github.com/why444216978/gin-api/library/signature"
+)
+
+// The optional interfaces of servicer.Servicer, the feature is disabled when the servicer does not implement it.
+
+// BreakerConfigGetter provides the circuit breaker config
+type BreakerConfigGetter interface {
+	GetBreakerConfig() breaker.Config
+}
+
+// RetryConfigGetter provides the retry policy
+type RetryConfigGetter interface {
+	GetRetryConfig() retry.Config
+}
+
+// TransportConfigGetter provides the config of the long-lived transport of every node
+type TransportConfigGetter interface {
+	GetTransportConfig() servicer.TransportConfig
+}
+
+// TLSConfigGetter provides the tls.Config, the request is sent by https when it is not nil
+type TLSConfigGetter interface {
+	GetTLSConfig() *tls.Config
+}
+
+// SignConfigGetter provides the config of request signing
+type SignConfigGetter interface {
+	GetSignConfig() signature.Config
+}
+
+func serviceBreakerConfig(service servicer.Servicer) breaker.Config {
+	if s, ok := service.(BreakerConfigGetter); ok {
+		return s.GetBreakerConfig()
+	}
+	return breaker.Config{}
+}
+
+func serviceRetryConfig(service servicer.Servicer) retry.Config {
+	if s, ok := service.(RetryConfigGetter); ok {
+		return s.GetRetryConfig()
+	}
+	return retry.Config{}
+}
+
+func serviceTransportConfig(service servicer.Servicer) servicer.TransportConfig {
+	if s, ok := service.(TransportConfigGetter); ok {
+		return s.GetTransportConfig()
+	}
+	return servicer.TransportConfig{}
+}
+
+func serviceTLSConfig(service servicer.Servicer) *tls.Config {
+	if s, ok := service.(TLSConfigGetter); ok {
+		return s.GetTLSConfig()
+	}
+	return nil
+}
+
+func serviceSignConfig(service servicer.Servicer) signature.Config {
+	if s, ok := service.(SignConfigGetter); ok {
+		return s.GetSignConfig()
+	}
+	return signature.Config{}
+}
@@ -0,0 +1,182 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	client "github.com/why444216978/gin-api/client/http"
+	"github.com/why444216978/gin-api/library/logger"
+	"github.com/why444216978/gin-api/library/selector"
+	"github.com/why444216978/gin-api/library/servicer"
+)
+
+// maxErrorBody is the max bytes of the error response body kept in *client.HTTPError
+const maxErrorBody = 1 << 20
+
+var _ client.Client = (*RPC)(nil)
+
+// Stream sends HTTP request with streaming body, the response body must be closed by the caller,
+// Servicer.Done and logging happen when the response body is closed.
+func (r *RPC) Stream(ctx context.Context, serviceName string, request client.StreamRequest) (response *client.StreamResponse, err error) {
+	var (
+		node   = &servicer.Node{}
+		start  = time.Now()
+		code   int
+		cancel = func() {}
+		done   = func(error) {}
+	)
+
+	if request.Header == nil {
+		request.Header = http.Header{}
+	}
+
+	// finish accounts and logs the stream, it is called once when the response body is closed or failed
+	finish := func(size int64, err error) {
+		done(err)
+		cancel()
+		r.logStream(ctx, serviceName, request, node, code, size, time.Since(start), err)
+	}
+	defer func() {
+		if err != nil {
+			finish(0, err)
+		}
+	}()
+
+	// 超时控制，覆盖读取响应body的整个过程
+	ctx, cancel, timeout, err := withTimeout(ctx, request.Timeout)
+	if err != nil {
+		return
+	}
+	defer func() { err = wrapTimeout(err, timeout) }()
+
+	service, ok := servicer.GetServicer(serviceName)
+	if !ok {
+		err = errors.New("service is nil")
+		return
+	}
+
+	picked, err := service.Pick(ctx)
+	if err != nil {
+		return
+	}
+	node = picked
+
+	req, err := r.newRequest(ctx, service, node, request.Method, request.URI, request.Header, request.Body)
+	if err != nil {
+		return
+	}
+	if request.ContentLength > 0 {
+		req.ContentLength = request.ContentLength
+	}
+
+	// 熔断
+	breakerDone, err := r.allowBreaker(serviceName, service, node)
+	if err != nil {
+		return
+	}
+
+	// 发送请求
+	if starter, ok := service.(servicer.Starter); ok {
+		_ = starter.Start(ctx, node)
+	}
+	done = func(err error) {
+		// 仅5xx计为节点失败，与Send一致
+		if httpErr, ok := client.AsHTTPError(err); ok && httpErr.Code < http.StatusInternalServerError {
+			err = nil
+		}
+		if err == nil && code >= http.StatusInternalServerError {
+			err = &client.HTTPError{Code: code}
+		}
+		// 插件、签名等本地中断，不计入节点结果
+		if client.IsAbort(err) {
+			err = selector.ErrCanceled
+		}
+		_ = service.Done(ctx, node, err)
+		breakerDone(err)
+	}
+	resp, err := r.getClient(serviceName, service, node).Do(req)
+
+	if err != nil {
+		return
+	}
+	code = resp.StatusCode
+
+	accept := request.AcceptStatus
+	if accept == nil {
+		accept = client.DefaultAcceptStatus
+	}
+	if !accept(code) {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		resp.Body.Close()
+		err = newHTTPError(resp, body)
+		return
+	}
+
+	response = &client.StreamResponse{
+		HTTPCode: code,
+		Header:   resp.Header,
+		Body: &streamBody{
+			body:    resp.Body,
+			timeout: timeout,
+			finish:  finish,
+		},
+	}
+
+	return
+}
+
+// streamBody calls finish with the bytes read and the first read error when it is closed
+type streamBody struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	once    sync.Once
+	size    int64
+	err     error
+	finish  func(size int64, err error)
+}
+
+func (b *streamBody) Read(p []byte) (n int, err error) {
+	n, err = b.body.Read(p)
+	b.size = b.size + int64(n)
+	if err != nil && err != io.EOF {
+		err = wrapTimeout(err, b.timeout)
+		if b.err == nil {
+			b.err = err
+		}
+	}
+	return
+}
+
+func (b *streamBody) Close() error {
+	err := b.body.Close()
+	b.once.Do(func() { b.finish(b.size, b.err) })
+	return err
+}
+
+func (r *RPC) logStream(ctx context.Context, serviceName string, request client.StreamRequest, node *servicer.Node, code int, size int64, cost time.Duration, err error) {
+	if r.logger == nil {
+		return
+	}
+
+	fields := []logger.Field{
+		logger.Reflect(logger.ServiceName, serviceName),
+		logger.Reflect(logger.Header, request.Header),
+		logger.Reflect(logger.Method, request.Method),
+		logger.Reflect(logger.API, request.URI),
+		logger.Reflect(logger.ServerIP, node.Host),
+		logger.Reflect(logger.ServerPort, node.Port),
+		logger.Reflect(logger.Code, code),
+		logger.Reflect(logger.Cost, cost.Milliseconds()),
+		logger.Reflect(logger.Timeout, request.Timeout),
+		logger.Reflect("stream_bytes", size),
+	}
+	if err == nil {
+		r.logger.Info(ctx, "rpc stream success", fields...)
+		return
+	}
+	r.logger.Error(ctx, err.Error(), fields...)
+}
@@ -0,0 +1,107 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+
+	client "github.com/why444216978/gin-api/client/http"
+	"github.com/why444216978/gin-api/library/servicer"
+)
+
+func TestRPC_Stream(t *testing.T) {
+	convey.Convey("TestRPC_Stream", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/echo":
+				_, _ = io.Copy(w, r.Body)
+			case "/ndjson":
+				for i := 0; i < 3; i++ {
+					_, _ = w.Write([]byte("{}\n"))
+					w.(http.Flusher).Flush()
+					time.Sleep(time.Millisecond * 10)
+				}
+			case "/slow":
+				w.(http.Flusher).Flush()
+				time.Sleep(time.Millisecond * 200)
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte("bad request"))
+			}
+		}))
+		defer server.Close()
+
+		s := &doneServicer{mockServicer: mockServicer{name: "test_stream", nodes: []*servicer.Node{newNode(t, server)}}}
+		servicer.SetServicer(s)
+		defer servicer.DelServicer(s)
+
+		convey.Convey("upload and download", func() {
+			pr, pw := io.Pipe()
+			go func() {
+				for i := 0; i < 3; i++ {
+					_, _ = pw.Write([]byte("chunk"))
+				}
+				_ = pw.Close()
+			}()
+
+			response, err := New().Stream(context.Background(), s.name, client.StreamRequest{
+				URI:    "/echo",
+				Method: http.MethodPost,
+				Body:   pr,
+			})
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusOK, response.HTTPCode)
+
+			b, err := ioutil.ReadAll(response.Body)
+			assert.Nil(t, err)
+			assert.Equal(t, strings.Repeat("chunk", 3), string(b))
+
+			// accounted when closed
+			assert.Equal(t, int32(0), atomic.LoadInt32(&s.done))
+			assert.Nil(t, response.Body.Close())
+			_ = response.Body.Close()
+			assert.Equal(t, int32(1), atomic.LoadInt32(&s.done))
+			assert.Equal(t, int32(0), atomic.LoadInt32(&s.fail))
+		})
+		convey.Convey("ndjson", func() {
+			response, err := New().Stream(context.Background(), s.name, client.StreamRequest{URI: "/ndjson", Method: http.MethodGet})
+			assert.Nil(t, err)
+			defer response.Body.Close()
+
+			b, err := ioutil.ReadAll(response.Body)
+			assert.Nil(t, err)
+			assert.Equal(t, 3, strings.Count(string(b), "\n"))
+		})
+		convey.Convey("error status", func() {
+			_, err := New().Stream(context.Background(), s.name, client.StreamRequest{URI: "/unknown", Method: http.MethodGet})
+			httpErr, ok := client.AsHTTPError(err)
+			assert.Equal(t, true, ok)
+			assert.Equal(t, http.StatusBadRequest, httpErr.Code)
+			assert.Equal(t, []byte("bad request"), httpErr.Raw)
+			assert.Equal(t, int32(1), atomic.LoadInt32(&s.done))
+			assert.Equal(t, int32(0), atomic.LoadInt32(&s.fail))
+		})
+		convey.Convey("timeout while reading", func() {
+			response, err := New().Stream(context.Background(), s.name, client.StreamRequest{
+				URI:     "/slow",
+				Method:  http.MethodGet,
+				Timeout: time.Millisecond * 50,
+			})
+			assert.Nil(t, err)
+
+			_, err = ioutil.ReadAll(response.Body)
+			assert.Equal(t, true, client.IsTimeout(err))
+			_ = response.Body.Close()
+			assert.Equal(t, int32(1), atomic.LoadInt32(&s.fail))
+		})
+	})
+}
@@ -0,0 +1,82 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+	"github.com/why444216978/codec/json"
+
+	client "github.com/why444216978/gin-api/client/http"
+	"github.com/why444216978/gin-api/library/servicer"
+	timeoutLib "github.com/why444216978/gin-api/server/http/middleware/timeout"
+)
+
+func TestWithTimeout(t *testing.T) {
+	convey.Convey("TestWithTimeout", t, func() {
+		convey.Convey("no timeout", func() {
+			ctx, cancel, timeout, err := withTimeout(context.Background(), 0)
+			defer cancel()
+			assert.Nil(t, err)
+			assert.Equal(t, time.Duration(0), timeout)
+			_, ok := ctx.Deadline()
+			assert.Equal(t, false, ok)
+		})
+		convey.Convey("request timeout", func() {
+			ctx, cancel, timeout, err := withTimeout(context.Background(), time.Second)
+			defer cancel()
+			assert.Nil(t, err)
+			assert.Equal(t, time.Second, timeout)
+			_, ok := ctx.Deadline()
+			assert.Equal(t, true, ok)
+		})
+		convey.Convey("propagated timeout is smaller", func() {
+			ctx := timeoutLib.SetStart(context.Background(), 100)
+			_, cancel, timeout, err := withTimeout(ctx, time.Second)
+			defer cancel()
+			assert.Nil(t, err)
+			assert.LessOrEqual(t, int64(timeout), int64(100*time.Millisecond))
+		})
+		convey.Convey("propagated timeout exceeded", func() {
+			ctx := timeoutLib.SetStart(context.Background(), -1)
+			_, _, _, err := withTimeout(ctx, time.Second)
+			assert.Equal(t, true, client.IsTimeout(err))
+		})
+	})
+}
+
+func TestRPC_SendTimeout(t *testing.T) {
+	convey.Convey("TestRPC_SendTimeout", t, func() {
+		header := make(chan string, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header <- r.Header.Get(timeoutLib.TimeoutKey)
+			time.Sleep(time.Millisecond * 200)
+		}))
+		defer server.Close()
+
+		s := &mockServicer{name: "test_timeout", nodes: []*servicer.Node{newNode(t, server)}}
+		servicer.SetServicer(s)
+		defer servicer.DelServicer(s)
+
+		convey.Convey("timeout error", func() {
+			start := time.Now()
+			err := New().Send(context.Background(), s.name, client.Request{
+				URI:     "/test",
+				Method:  http.MethodGet,
+				Timeout: time.Millisecond * 50,
+				Codec:   json.JSONCodec{},
+			}, &client.Response{Body: &map[string]interface{}{}, Codec: json.JSONCodec{}})
+			assert.Equal(t, true, client.IsTimeout(err))
+			assert.Less(t, int64(time.Since(start)), int64(time.Millisecond*150))
+
+			remain, _ := strconv.ParseInt(<-header, 10, 64)
+			assert.Greater(t, remain, int64(0))
+			assert.LessOrEqual(t, remain, int64(50))
+		})
+	})
+}
@@ -1,29 +1,43 @@
 package transport
 
 import (
+	"bytes"
 	"context"
-	"crypto/tls"
-	"crypto/x509"
 	"errors"
 	"fmt"
-	"net"
+	"io"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/why444216978/go-util/assert"
 
 	client "github.com/why444216978/gin-api/client/http"
+	"github.com/why444216978/gin-api/library/breaker"
+	"github.com/why444216978/gin-api/library/cache"
 	"github.com/why444216978/gin-api/library/logger"
 	loggerRPC "github.com/why444216978/gin-api/library/logger/zap/rpc"
+	"github.com/why444216978/gin-api/library/retry"
+	"github.com/why444216978/gin-api/library/selector"
 	"github.com/why444216978/gin-api/library/servicer"
 	timeoutLib "github.com/why444216978/gin-api/server/http/middleware/timeout"
 )
 
+// maxPickTimes is the max times to pick a node which has not been tried when retry
+const maxPickTimes = 3
+
 type RPC struct {
-	logger        logger.Logger
-	beforePlugins []client.BeforeRequestPlugin
-	afterPlugins  []client.AfterRequestPlugin
+	logger               logger.Logger
+	beforePlugins        []client.BeforeRequestPlugin
+	afterPlugins         []client.AfterRequestPlugin
+	middlewares          []client.Middleware
+	breakers             sync.Map
+	budgets              sync.Map
+	pools                sync.Map
+	latencies            sync.Map
+	onBreakerStateChange breaker.StateChangeFunc
+	cacher               cache.Cacher
 }
 
 type Option func(r *RPC)
@@ -40,6 +54,22 @@ func WithAfterPlugins(plugins ...client.AfterRequestPlugin) Option {
 	return func(r *RPC) { r.afterPlugins = plugins }
 }
 
+// WithMiddlewares set the middlewares wrapping the transport of every node,
+// they run inside the before plugins and outside the after plugins
+func WithMiddlewares(middlewares ...client.Middleware) Option {
+	return func(r *RPC) { r.middlewares = middlewares }
+}
+
+// WithBreakerStateChange set the func called when breaker state changes, such as reporting metrics
+func WithBreakerStateChange(f breaker.StateChangeFunc) Option {
+	return func(r *RPC) { r.onBreakerStateChange = f }
+}
+
+// WithCacher set the cache of GET responses, it is used by the requests with client.Request.Cache
+func WithCacher(c cache.Cacher) Option {
+	return func(r *RPC) { r.cacher = c }
+}
+
 func New(opts ...Option) *RPC {
 	r := &RPC{}
 	for _, o := range opts {
@@ -52,8 +82,9 @@ func New(opts ...Option) *RPC {
 // Send is send HTTP request
 func (r *RPC) Send(ctx context.Context, serviceName string, request client.Request, response *client.Response) (err error) {
 	var (
-		cost int64
-		node = &servicer.Node{}
+		cost        int64
+		node        = &servicer.Node{}
+		cacheStatus string
 	)
 
 	if response == nil {
@@ -89,6 +120,9 @@ func (r *RPC) Send(ctx context.Context, serviceName string, request client.Reque
 			logger.Reflect(logger.Cost, cost),
 			logger.Reflect(logger.Timeout, request.Timeout),
 		}
+		if cacheStatus != "" {
+			fields = append(fields, logger.Reflect("cache", cacheStatus))
+		}
 		if err == nil {
 			r.logger.Info(ctx, "rpc success", fields...)
 			return
@@ -96,15 +130,18 @@ func (r *RPC) Send(ctx context.Context, serviceName string, request client.Reque
 		r.logger.Error(ctx, err.Error(), fields...)
 	}()
 
-	reqReader, err := request.Codec.Encode(request.Body)
+	// 超时控制，取请求超时和上游传递超时的较小值
+	ctx, cancelTimeout, timeout, err := withTimeout(ctx, request.Timeout)
 	if err != nil {
 		return
 	}
+	defer cancelTimeout()
+	defer func() { err = wrapTimeout(err, timeout) }()
 
-	var (
-		client *http.Client
-		req    *http.Request
-	)
+	body, err := encodeBody(request)
+	if err != nil {
+		return
+	}
 
 	service, ok := servicer.GetServicer(serviceName)
 	if !ok {
@@ -112,115 +149,403 @@ func (r *RPC) Send(ctx context.Context, serviceName string, request client.Reque
 		return
 	}
 
-	client, node, err = r.getClient(ctx, serviceName, service)
+	// 请求开始时间
+	start := time.Now()
+
+	// 响应缓存
+	if r.cacher != nil && request.Cache != nil && request.Method == http.MethodGet {
+		var cachedNode *servicer.Node
+		cachedNode, cacheStatus, err = r.sendCache(ctx, serviceName, service, request, body, response)
+		if cachedNode != nil {
+			node = cachedNode
+		}
+		cost = time.Since(start).Milliseconds()
+		return
+	}
+
+	node, resp, cancel, err := r.roundTrip(ctx, serviceName, service, request, body)
+	defer cancel()
+	cost = time.Since(start).Milliseconds()
 	if err != nil {
 		return
 	}
+	defer resp.Body.Close()
+
+	err = decodeResponse(request, response, resp)
+
+	return
+}
 
+// roundTrip sends request with retry, the returned cancel must be called after the response body is read
+func (r *RPC) roundTrip(ctx context.Context, serviceName string, service servicer.Servicer, request client.Request, body []byte) (
+	node *servicer.Node, resp *http.Response, cancel func(), err error) {
+	// 重试策略
+	var (
+		retryConfig = serviceRetryConfig(service)
+		maxAttempts = 1
+		budget      *retry.Budget
+	)
+	if retryConfig.Enabled() && retryConfig.RetryableMethod(request.Method) {
+		maxAttempts = retryConfig.MaxAttempts
+		budget = r.getBudget(serviceName, retryConfig)
+	}
+
+	var (
+		attemptCancel context.CancelFunc
+		cancels       []context.CancelFunc
+		tried         = make(map[string]struct{})
+	)
+	cancel = func() {
+		for _, c := range cancels {
+			c()
+		}
+	}
+	for attempt := 1; ; attempt++ {
+		node, resp, attemptCancel, err = r.do(ctx, serviceName, service, request, body, tried)
+		cancels = append(cancels, attemptCancel)
+		if node == nil {
+			node = &servicer.Node{}
+		}
+
+		// 本地中断不重试，也不计入重试预算
+		if client.IsAbort(err) {
+			return
+		}
+
+		retryable := retry.RetryableError(err) || (err == nil && retryConfig.RetryableCode(resp.StatusCode))
+		if budget != nil {
+			if retryable {
+				budget.OnFailure()
+			} else {
+				budget.OnSuccess()
+			}
+		}
+		if !retryable || attempt >= maxAttempts || budget == nil || !budget.Allow() {
+			return
+		}
+
+		backoff := retryConfig.Backoff(attempt)
+		if !hasRemainTime(ctx, backoff) {
+			return
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		r.logRetry(ctx, serviceName, node, attempt, resp, err)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			resp, err = nil, ctx.Err()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// decodeResponse decodes the body to response.Body if the HTTP code is accepted,
+// or returns *client.HTTPError with the body decoded to response.ErrorBody.
+func decodeResponse(request client.Request, response *client.Response, resp *http.Response) error {
+	response.HTTPCode = resp.StatusCode
+	response.Header = resp.Header
+
+	accept := request.AcceptStatus
+	if accept == nil {
+		accept = client.DefaultAcceptStatus
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if !accept(resp.StatusCode) {
+		httpErr := newHTTPError(resp, body)
+		if response.ErrorBody != nil && len(body) > 0 {
+			if err := response.Codec.Decode(bytes.NewReader(body), response.ErrorBody); err == nil {
+				httpErr.Body = response.ErrorBody
+			}
+		}
+		return httpErr
+	}
+
+	// 204等无body的响应
+	if len(body) == 0 {
+		return nil
+	}
+
+	return response.Codec.Decode(bytes.NewReader(body), response.Body)
+}
+
+// newRequest builds the request to node
+func (r *RPC) newRequest(ctx context.Context, service servicer.Servicer, node *servicer.Node, method, uri string, header http.Header, body io.Reader) (*http.Request, error) {
 	// 构建req
-	url := fmt.Sprintf("http://%s:%d%s", node.Host, node.Port, request.URI)
-	req, err = http.NewRequestWithContext(ctx, request.Method, url, reqReader)
+	scheme := "http"
+	if serviceTLSConfig(service) != nil {
+		scheme = "https"
+	}
+	url := fmt.Sprintf("%s://%s:%d%s", scheme, node.Host, node.Port, uri)
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
-		return
+		return nil, err
 	}
 
 	// 超时传递
-	remain, err := timeoutLib.CalcRemainTimeout(ctx)
+	remain, err := remainTimeout(ctx)
 	if err != nil {
-		return
+		return nil, err
 	}
-	request.Header.Set(timeoutLib.TimeoutKey, strconv.FormatInt(remain, 10))
 
-	// 设置请求header
-	req.Header = request.Header
+	// 设置请求header，每次请求独立，避免插件重复添加及并发写
+	req.Header = header.Clone()
+	req.Header.Set(timeoutLib.TimeoutKey, strconv.FormatInt(remain, 10))
 
-	// 请求结束前插件
-	for _, plugin := range r.beforePlugins {
-		_ = plugin.Handle(ctx, req)
+	return req, nil
+}
+
+func newHTTPError(resp *http.Response, body []byte) *client.HTTPError {
+	return &client.HTTPError{
+		Code:   resp.StatusCode,
+		Header: resp.Header,
+		Raw:    body,
 	}
+}
 
-	// 请求开始时间
-	start := time.Now()
+// do sends the request to a node which has not been tried if possible,
+// cancel must be called after the response body is read.
+func (r *RPC) do(ctx context.Context, serviceName string, service servicer.Servicer, request client.Request, body []byte, tried map[string]struct{}) (node *servicer.Node, resp *http.Response, cancel context.CancelFunc, err error) {
+	if delay, ok := r.hedgeDelay(serviceName, request.Hedge); ok {
+		return r.hedge(ctx, serviceName, service, request, body, tried, delay)
+	}
+
+	cancel = func() {}
+	if node, err = pickNode(ctx, service, tried); err != nil {
+		return
+	}
+	resp, err = r.attempt(ctx, ctx, serviceName, service, request, body, node)
+
+	return
+}
+
+// attempt sends the request once to node, parent is the context of Send,
+// the attempt canceled by hedging is reported as selector.ErrCanceled, neither success nor failure.
+func (r *RPC) attempt(ctx, parent context.Context, serviceName string, service servicer.Servicer, request client.Request, body []byte, node *servicer.Node) (resp *http.Response, err error) {
+	httpClient := r.getClient(serviceName, service, node)
+
+	req, err := r.newRequest(ctx, service, node, request.Method, request.URI, request.Header, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
 
 	// 判断是否cancel
 	if err = ctx.Err(); err != nil {
 		return
 	}
 
+	// 熔断
+	breakerDone, err := r.allowBreaker(serviceName, service, node)
+	if err != nil {
+		return
+	}
+
 	// 发送请求
-	resp, err := client.Do(req)
+	start := time.Now()
+	if starter, ok := service.(servicer.Starter); ok {
+		_ = starter.Start(ctx, node)
+	}
+	resp, err = httpClient.Do(req)
+
+	doneErr := err
+	switch {
+	case err == nil && resp.StatusCode >= http.StatusInternalServerError:
+		// 5xx计为节点失败，熔断、离群检测和selector使用同一失败定义
+		doneErr = newHTTPError(resp, nil)
+	case client.IsAbort(err):
+		// 插件、签名等本地中断，不计入节点结果
+		doneErr = selector.ErrCanceled
+	case err != nil && ctx.Err() != nil && parent.Err() == nil:
+		// 对冲请求中被取消的一方，只释放在途状态，不计成功或失败
+		doneErr = selector.ErrCanceled
+	}
+	_ = service.Done(ctx, node, doneErr)
+	breakerDone(doneErr)
+
+	if err == nil {
+		r.getLatency(serviceName).record(time.Since(start))
+	}
 
-	_ = service.Done(ctx, node, err)
+	return
+}
 
-	// 请求结束后插件
-	for _, plugin := range r.afterPlugins {
-		_ = plugin.Handle(ctx, req, resp)
+func (r *RPC) getBudget(serviceName string, cfg retry.Config) *retry.Budget {
+	b, ok := r.budgets.Load(serviceName)
+	if !ok {
+		b, _ = r.budgets.LoadOrStore(serviceName, retry.NewBudget(cfg.BudgetTokens, cfg.BudgetTokenRatio))
 	}
+	return b.(*retry.Budget)
+}
 
-	cost = time.Since(start).Milliseconds()
-	if err != nil {
+func (r *RPC) logRetry(ctx context.Context, serviceName string, node *servicer.Node, attempt int, resp *http.Response, err error) {
+	if r.logger == nil {
 		return
 	}
-	defer resp.Body.Close()
 
-	response.HTTPCode = resp.StatusCode
-	if resp.StatusCode != http.StatusOK {
-		err = fmt.Errorf("http code is %d", resp.StatusCode)
-		return
+	fields := []logger.Field{
+		logger.Reflect(logger.ServiceName, serviceName),
+		logger.Reflect(logger.ServerIP, node.Host),
+		logger.Reflect(logger.ServerPort, node.Port),
+		logger.Reflect("attempt", attempt),
+	}
+	if resp != nil {
+		fields = append(fields, logger.Reflect(logger.Code, resp.StatusCode))
 	}
+	if err != nil {
+		fields = append(fields, logger.Error(err))
+	}
+	r.logger.Warn(ctx, "rpc retry", fields...)
+}
 
-	err = response.Codec.Decode(resp.Body, response.Body)
+// encodeBody encodes the request body to bytes, so that it can be sent more than once
+func encodeBody(request client.Request) ([]byte, error) {
+	reader, err := request.Codec.Encode(request.Body)
+	if err != nil {
+		return nil, err
+	}
+	if reader == nil {
+		return nil, nil
+	}
+	return io.ReadAll(reader)
+}
+
+// pickNode picks a node and marks it as tried, it tries to avoid the nodes which have been tried
+func pickNode(ctx context.Context, service servicer.Servicer, tried map[string]struct{}) (node *servicer.Node, err error) {
+	var address string
+	for i := 0; i < maxPickTimes; i++ {
+		if node, err = service.Pick(ctx); err != nil {
+			return
+		}
+		address = selector.GenerateAddress(node.Host, node.Port)
+		if _, ok := tried[address]; !ok {
+			break
+		}
+	}
+	tried[address] = struct{}{}
 
 	return
 }
 
-func (r *RPC) getClient(ctx context.Context, serviceName string, service servicer.Servicer) (client *http.Client, node *servicer.Node, err error) {
-	node, err = service.Pick(ctx)
+// withTimeout sets the deadline of ctx to the smaller of timeout and the propagated remain timeout,
+// ctx is not changed when both are zero.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc, time.Duration, error) {
+	remain, err := timeoutLib.CalcRemainTimeout(ctx)
 	if err != nil {
-		return
+		return ctx, func() {}, timeout, &client.TimeoutError{Duration: timeout, Err: err}
 	}
 
-	address := fmt.Sprintf("%s:%d", node.Host, node.Port)
+	if propagated := time.Duration(remain) * time.Millisecond; propagated > 0 && (timeout <= 0 || propagated < timeout) {
+		timeout = propagated
+	}
+	if timeout <= 0 {
+		return ctx, func() {}, 0, nil
+	}
 
-	tp := &http.Transport{
-		MaxIdleConnsPerHost: 30,
-		MaxConnsPerHost:     30,
-		IdleConnTimeout:     time.Minute,
-		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
-			conn, err := (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 60 * time.Second,
-			}).DialContext(context.TODO(), "tcp", address)
-			if err != nil {
-				return nil, err
-			}
-			return conn, nil
-		},
-		DialTLSContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
-			pool := x509.NewCertPool()
-			pool.AppendCertsFromPEM(service.GetCaCrt())
-			cliCrt, err := tls.X509KeyPair(service.GetClientPem(), service.GetClientKey())
-			if err != nil {
-				err = errors.New("server pem error " + err.Error())
-				return nil, err
-			}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, cancel, timeout, nil
+}
 
-			conn, err := (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 60 * time.Second,
-			}).DialContext(context.TODO(), "tcp", address)
-			if err != nil {
-				return nil, err
-			}
+// wrapTimeout wraps the deadline exceeded error to *client.TimeoutError
+func wrapTimeout(err error, timeout time.Duration) error {
+	if errors.Is(err, context.DeadlineExceeded) && !client.IsTimeout(err) {
+		return &client.TimeoutError{Duration: timeout, Err: err}
+	}
+	return err
+}
 
-			return tls.Client(conn, &tls.Config{
-				RootCAs:      pool,
-				Certificates: []tls.Certificate{cliCrt},
-				ServerName:   serviceName,
-			}), err
-		},
+// remainTimeout returns the remain milliseconds before the deadline of ctx, zero means no timeout
+func remainTimeout(ctx context.Context) (int64, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return timeoutLib.CalcRemainTimeout(ctx)
 	}
-	client = &http.Client{Transport: tp}
 
-	return
+	remain := time.Until(deadline).Milliseconds()
+	if remain <= 0 {
+		return 0, context.DeadlineExceeded
+	}
+	return remain, nil
+}
+
+// hasRemainTime checks whether the remain timeout is enough for backoff
+func hasRemainTime(ctx context.Context, backoff time.Duration) bool {
+	remain, err := timeoutLib.CalcRemainTimeout(ctx)
+	if err != nil {
+		return false
+	}
+	if remain > 0 && time.Duration(remain)*time.Millisecond <= backoff {
+		return false
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= backoff {
+		return false
+	}
+
+	return true
+}
+
+// BreakerStates returns the state of all breakers, such as for metrics
+func (r *RPC) BreakerStates() map[string]breaker.State {
+	states := make(map[string]breaker.State)
+	r.breakers.Range(func(key, value interface{}) bool {
+		states[key.(string)] = value.(*breaker.Breaker).State()
+		return true
+	})
+	return states
+}
+
+// allowBreaker checks the breaker of service or node, done must be called with the error reported to servicer,
+// selector.ErrCanceled releases the request without counting success or failure.
+func (r *RPC) allowBreaker(serviceName string, service servicer.Servicer, node *servicer.Node) (done func(err error), err error) {
+	cfg := serviceBreakerConfig(service)
+	if !cfg.Enabled() {
+		return func(error) {}, nil
+	}
+
+	name := serviceName
+	if cfg.ByNode {
+		name = fmt.Sprintf("%s@%s:%d", serviceName, node.Host, node.Port)
+	}
+
+	b, ok := r.breakers.Load(name)
+	if !ok {
+		b, _ = r.breakers.LoadOrStore(name, breaker.New(name, cfg, breaker.WithStateChange(r.breakerStateChange)))
+	}
+
+	breakerDone, release, err := b.(*breaker.Breaker).Acquire()
+	if err != nil {
+		return
+	}
+
+	return func(err error) {
+		if selector.IsCanceled(err) {
+			release()
+			return
+		}
+		breakerDone(err == nil)
+	}, nil
+}
+
+func (r *RPC) breakerStateChange(name string, from, to breaker.State) {
+	if r.onBreakerStateChange != nil {
+		r.onBreakerStateChange(name, from, to)
+	}
+
+	if r.logger == nil {
+		return
+	}
+	r.logger.Warn(context.Background(), "breaker state change",
+		logger.Reflect(logger.ServiceName, name),
+		logger.Reflect("from", from.String()),
+		logger.Reflect("to", to.String()))
 }
@@ -0,0 +1,501 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+	"github.com/why444216978/codec/json"
+
+	client "github.com/why444216978/gin-api/client/http"
+	"github.com/why444216978/gin-api/library/breaker"
+	"github.com/why444216978/gin-api/library/registry"
+	"github.com/why444216978/gin-api/library/retry"
+	"github.com/why444216978/gin-api/library/selector"
+	"github.com/why444216978/gin-api/library/servicer"
+	"github.com/why444216978/gin-api/library/servicer/service"
+	"github.com/why444216978/gin-api/library/signature"
+)
+
+type mockServicer struct {
+	name    string
+	onDone  func(node *servicer.Node, err error)
+	nodes   []*servicer.Node
+	index   uint32
+	breaker breaker.Config
+	retry   retry.Config
+	sign    signature.Config
+}
+
+var (
+	_ servicer.Servicer     = (*mockServicer)(nil)
+	_ servicer.Starter      = (*mockServicer)(nil)
+	_ BreakerConfigGetter   = (*mockServicer)(nil)
+	_ RetryConfigGetter     = (*mockServicer)(nil)
+	_ TransportConfigGetter = (*mockServicer)(nil)
+	_ TLSConfigGetter       = (*mockServicer)(nil)
+	_ SignConfigGetter      = (*mockServicer)(nil)
+	_ servicer.NodeGetter   = (*mockServicer)(nil)
+)
+
+// the servicer of library implements all of the optional interfaces
+var (
+	_ servicer.Starter      = (*service.Service)(nil)
+	_ BreakerConfigGetter   = (*service.Service)(nil)
+	_ RetryConfigGetter     = (*service.Service)(nil)
+	_ TransportConfigGetter = (*service.Service)(nil)
+	_ TLSConfigGetter       = (*service.Service)(nil)
+	_ SignConfigGetter      = (*service.Service)(nil)
+	_ servicer.NodeGetter   = (*service.Service)(nil)
+)
+
+func (s *mockServicer) Name() string { return s.name }
+
+func (s *mockServicer) Pick(ctx context.Context) (*servicer.Node, error) {
+	i := atomic.AddUint32(&s.index, 1)
+	return s.nodes[int(i-1)%len(s.nodes)], nil
+}
+
+func (s *mockServicer) Start(ctx context.Context, node *servicer.Node) error { return nil }
+
+func (s *mockServicer) Done(ctx context.Context, node *servicer.Node, err error) error {
+	if s.onDone != nil {
+		s.onDone(node, err)
+	}
+	return nil
+}
+
+func (s *mockServicer) GetCaCrt() []byte { return nil }
+
+func (s *mockServicer) GetClientPem() []byte { return nil }
+
+func (s *mockServicer) GetClientKey() []byte { return nil }
+
+func (s *mockServicer) GetBreakerConfig() breaker.Config { return s.breaker }
+
+func (s *mockServicer) GetRetryConfig() retry.Config { return s.retry }
+
+func (s *mockServicer) GetTransportConfig() servicer.TransportConfig {
+	return servicer.TransportConfig{}
+}
+
+func (s *mockServicer) GetNodes() ([]*servicer.Node, error) { return s.nodes, nil }
+
+func (s *mockServicer) GetTLSConfig() *tls.Config { return nil }
+
+func (s *mockServicer) GetSignConfig() signature.Config { return s.sign }
+
+func newNode(t *testing.T, server *httptest.Server) *servicer.Node {
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	assert.Nil(t, err)
+	p, _ := strconv.Atoi(port)
+	return &servicer.Node{Host: host, Port: p}
+}
+
+func newServer(code int, count *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(count, 1)
+		w.WriteHeader(code)
+		_, _ = w.Write([]byte(`{"code":0}`))
+	}))
+}
+
+func TestRPC_Send(t *testing.T) {
+	convey.Convey("TestRPC_Send", t, func() {
+		var badCount, goodCount int32
+		bad := newServer(http.StatusServiceUnavailable, &badCount)
+		defer bad.Close()
+		good := newServer(http.StatusOK, &goodCount)
+		defer good.Close()
+
+		send := func(s *mockServicer, method string) (client.Response, error) {
+			servicer.SetServicer(s)
+			defer servicer.DelServicer(s)
+
+			response := client.Response{Body: &map[string]interface{}{}, Codec: json.JSONCodec{}}
+			err := New().Send(context.Background(), s.name, client.Request{
+				URI:    "/test",
+				Method: method,
+				Body:   map[string]interface{}{"a": 1},
+				Codec:  json.JSONCodec{},
+			}, &response)
+			return response, err
+		}
+
+		convey.Convey("retry another node", func() {
+			atomic.StoreInt32(&badCount, 0)
+			atomic.StoreInt32(&goodCount, 0)
+			s := &mockServicer{
+				name:  "test_retry",
+				nodes: []*servicer.Node{newNode(t, bad), newNode(t, good)},
+				retry: retry.Config{MaxAttempts: 2},
+			}
+			response, err := send(s, http.MethodGet)
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusOK, response.HTTPCode)
+			assert.Equal(t, int32(1), atomic.LoadInt32(&badCount))
+			assert.Equal(t, int32(1), atomic.LoadInt32(&goodCount))
+		})
+		convey.Convey("non-idempotent method not retried", func() {
+			atomic.StoreInt32(&badCount, 0)
+			s := &mockServicer{
+				name:  "test_retry_post",
+				nodes: []*servicer.Node{newNode(t, bad), newNode(t, good)},
+				retry: retry.Config{MaxAttempts: 2},
+			}
+			response, err := send(s, http.MethodPost)
+			assert.NotNil(t, err)
+			assert.Equal(t, http.StatusServiceUnavailable, response.HTTPCode)
+			assert.Equal(t, int32(1), atomic.LoadInt32(&badCount))
+		})
+		convey.Convey("max attempts", func() {
+			atomic.StoreInt32(&badCount, 0)
+			s := &mockServicer{
+				name:  "test_retry_max",
+				nodes: []*servicer.Node{newNode(t, bad)},
+				retry: retry.Config{MaxAttempts: 3},
+			}
+			_, err := send(s, http.MethodGet)
+			assert.NotNil(t, err)
+			assert.Equal(t, int32(3), atomic.LoadInt32(&badCount))
+		})
+		convey.Convey("breaker open", func() {
+			atomic.StoreInt32(&badCount, 0)
+			s := &mockServicer{
+				name:    "test_breaker",
+				nodes:   []*servicer.Node{newNode(t, bad)},
+				breaker: breaker.Config{ConsecutiveFailures: 1},
+			}
+			servicer.SetServicer(s)
+			defer servicer.DelServicer(s)
+
+			r := New()
+			request := client.Request{URI: "/test", Method: http.MethodGet, Codec: json.JSONCodec{}}
+			err := r.Send(context.Background(), s.name, request, &client.Response{Body: &map[string]interface{}{}, Codec: json.JSONCodec{}})
+			assert.NotNil(t, err)
+
+			err = r.Send(context.Background(), s.name, request, &client.Response{Body: &map[string]interface{}{}, Codec: json.JSONCodec{}})
+			openErr := &breaker.OpenError{}
+			assert.ErrorAs(t, err, &openErr)
+			assert.Equal(t, int32(1), atomic.LoadInt32(&badCount))
+			assert.Equal(t, breaker.StateOpen, r.BreakerStates()["test_breaker"])
+		})
+	})
+}
+
+// basicServicer implements none of the optional interfaces
+type basicServicer struct {
+	name string
+	node *servicer.Node
+}
+
+func (s *basicServicer) Name() string { return s.name }
+
+func (s *basicServicer) Pick(ctx context.Context) (*servicer.Node, error) { return s.node, nil }
+
+func (s *basicServicer) Done(ctx context.Context, node *servicer.Node, err error) error { return nil }
+
+func (s *basicServicer) GetCaCrt() []byte { return nil }
+
+func (s *basicServicer) GetClientPem() []byte { return nil }
+
+func (s *basicServicer) GetClientKey() []byte { return nil }
+
+func TestRPC_SendBasicServicer(t *testing.T) {
+	convey.Convey("TestRPC_SendBasicServicer", t, func() {
+		convey.Convey("optional interfaces not implemented", func() {
+			var count int32
+			server := newServer(http.StatusOK, &count)
+			defer server.Close()
+
+			s := &basicServicer{name: "test_basic", node: newNode(t, server)}
+			servicer.SetServicer(s)
+			defer servicer.DelServicer(s)
+
+			response := &client.Response{Body: &map[string]interface{}{}, Codec: json.JSONCodec{}}
+			err := New().Send(context.Background(), s.name, client.Request{
+				URI:    "/test",
+				Method: http.MethodGet,
+				Codec:  json.JSONCodec{},
+			}, response)
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusOK, response.HTTPCode)
+			assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+		})
+	})
+}
+
+type staticDiscovery struct{ nodes []*registry.Node }
+
+func (d *staticDiscovery) GetNodes() []*registry.Node { return d.nodes }
+
+func (d *staticDiscovery) GetUpdateTime() time.Time { return time.Time{} }
+
+func (d *staticDiscovery) Close() error { return nil }
+
+func TestRPC_SendOutlier(t *testing.T) {
+	convey.Convey("TestRPC_SendOutlier", t, func() {
+		convey.Convey("5xx node is ejected", func() {
+			var badCount, goodCount int32
+			bad := newServer(http.StatusBadGateway, &badCount)
+			defer bad.Close()
+			good := newServer(http.StatusOK, &goodCount)
+			defer good.Close()
+
+			badNode, goodNode := newNode(t, bad), newNode(t, good)
+			s, err := service.NewService(&service.Config{
+				ServiceName: "test_outlier",
+				Type:        servicer.TypeRegistry,
+				Host:        goodNode.Host,
+				Port:        goodNode.Port,
+				Selector:    selector.TypeWrr,
+				Outlier:     service.OutlierConfig{ConsecutiveErrors: 2, MaxEjectionPercent: 50},
+			}, service.WithDiscovery(&staticDiscovery{nodes: []*registry.Node{
+				{Host: badNode.Host, Port: badNode.Port, Weight: 1},
+				{Host: goodNode.Host, Port: goodNode.Port, Weight: 1},
+			}}))
+			assert.Nil(t, err)
+			servicer.SetServicer(s)
+			defer servicer.DelServicer(s)
+
+			r := New()
+			send := func() error {
+				return r.Send(context.Background(), s.Name(), client.Request{
+					URI:    "/test",
+					Method: http.MethodGet,
+					Codec:  json.JSONCodec{},
+				}, &client.Response{Body: &map[string]interface{}{}, Codec: json.JSONCodec{}})
+			}
+			for i := 0; i < 4; i++ {
+				_ = send()
+			}
+			assert.Equal(t, int32(2), atomic.LoadInt32(&badCount))
+
+			for i := 0; i < 10; i++ {
+				assert.Nil(t, send())
+			}
+			assert.Equal(t, int32(2), atomic.LoadInt32(&badCount))
+		})
+	})
+}
+
+type abortPlugin struct{ calls int32 }
+
+func (p *abortPlugin) Handle(ctx context.Context, req *http.Request) error {
+	atomic.AddInt32(&p.calls, 1)
+	return assert.AnError
+}
+
+func TestRPC_SendAbort(t *testing.T) {
+	convey.Convey("TestRPC_SendAbort", t, func() {
+		convey.Convey("local abort is not node failure", func() {
+			var count int32
+			server := newServer(http.StatusOK, &count)
+			defer server.Close()
+
+			var doneErrs []error
+			s := &mockServicer{
+				name:    "test_abort",
+				nodes:   []*servicer.Node{newNode(t, server)},
+				retry:   retry.Config{MaxAttempts: 3},
+				breaker: breaker.Config{ConsecutiveFailures: 1},
+				onDone:  func(node *servicer.Node, err error) { doneErrs = append(doneErrs, err) },
+			}
+			servicer.SetServicer(s)
+			defer servicer.DelServicer(s)
+
+			plugin := &abortPlugin{}
+			r := New(WithBeforePlugins(plugin))
+			for i := 0; i < 2; i++ {
+				err := r.Send(context.Background(), s.name, client.Request{
+					URI:    "/test",
+					Method: http.MethodGet,
+					Codec:  json.JSONCodec{},
+				}, &client.Response{Body: &map[string]interface{}{}, Codec: json.JSONCodec{}})
+				assert.ErrorIs(t, err, assert.AnError)
+				assert.Equal(t, true, client.IsAbort(err))
+			}
+
+			// 不重试，不打开熔断，不计为节点失败
+			assert.Equal(t, int32(2), atomic.LoadInt32(&plugin.calls))
+			assert.Equal(t, int32(0), atomic.LoadInt32(&count))
+			assert.Equal(t, breaker.StateClosed, r.BreakerStates()[s.name])
+			assert.Equal(t, []error{selector.ErrCanceled, selector.ErrCanceled}, doneErrs)
+		})
+	})
+}
+
+func TestDecodeResponse(t *testing.T) {
+	convey.Convey("TestDecodeResponse", t, func() {
+		newResp := func(code int, body string) *http.Response {
+			rec := httptest.NewRecorder()
+			rec.Header().Set("X-Test", "test")
+			rec.WriteHeader(code)
+			_, _ = rec.WriteString(body)
+			return rec.Result()
+		}
+
+		convey.Convey("created", func() {
+			body := map[string]interface{}{}
+			response := &client.Response{Body: &body, Codec: json.JSONCodec{}}
+			err := decodeResponse(client.Request{}, response, newResp(http.StatusCreated, `{"id":1}`))
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusCreated, response.HTTPCode)
+			assert.Equal(t, "test", response.Header.Get("X-Test"))
+			assert.Equal(t, float64(1), body["id"])
+		})
+		convey.Convey("no content", func() {
+			response := &client.Response{Body: &map[string]interface{}{}, Codec: json.JSONCodec{}}
+			err := decodeResponse(client.Request{}, response, newResp(http.StatusNoContent, ""))
+			assert.Nil(t, err)
+			assert.Equal(t, http.StatusNoContent, response.HTTPCode)
+		})
+		convey.Convey("custom accept status", func() {
+			response := &client.Response{Body: &map[string]interface{}{}, Codec: json.JSONCodec{}}
+			request := client.Request{AcceptStatus: client.AcceptStatus(http.StatusOK)}
+			err := decodeResponse(request, response, newResp(http.StatusCreated, `{}`))
+			httpErr, ok := client.AsHTTPError(err)
+			assert.Equal(t, true, ok)
+			assert.Equal(t, http.StatusCreated, httpErr.Code)
+		})
+		convey.Convey("error body", func() {
+			errBody := map[string]interface{}{}
+			response := &client.Response{Body: &map[string]interface{}{}, ErrorBody: &errBody, Codec: json.JSONCodec{}}
+			err := decodeResponse(client.Request{}, response, newResp(http.StatusBadRequest, `{"errmsg":"invalid"}`))
+			httpErr, ok := client.AsHTTPError(err)
+			assert.Equal(t, true, ok)
+			assert.Equal(t, http.StatusBadRequest, httpErr.Code)
+			assert.Equal(t, "test", httpErr.Header.Get("X-Test"))
+			assert.Equal(t, []byte(`{"errmsg":"invalid"}`), httpErr.Raw)
+			assert.Equal(t, &errBody, httpErr.Body)
+			assert.Equal(t, "invalid", errBody["errmsg"])
+		})
+	})
+}
+
+func TestRPC_SendMiddlewares(t *testing.T) {
+	convey.Convey("TestRPC_SendMiddlewares", t, func() {
+		convey.Convey("mock response without network", func() {
+			s := &mockServicer{name: "test_middleware", nodes: []*servicer.Node{{Host: "127.0.0.1", Port: 1}}}
+			servicer.SetServicer(s)
+			defer servicer.DelServicer(s)
+
+			mock := func(next http.RoundTripper) http.RoundTripper {
+				return client.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Header:     http.Header{},
+						Body:       ioutil.NopCloser(strings.NewReader(`{"mock":true}`)),
+						Request:    req,
+					}, nil
+				})
+			}
+
+			body := map[string]interface{}{}
+			response := &client.Response{Body: &body, Codec: json.JSONCodec{}}
+			err := New(WithMiddlewares(mock)).Send(context.Background(), s.name, client.Request{
+				URI:    "/test",
+				Method: http.MethodGet,
+				Codec:  json.JSONCodec{},
+			}, response)
+			assert.Nil(t, err)
+			assert.Equal(t, true, body["mock"])
+		})
+		convey.Convey("abort", func() {
+			s := &mockServicer{name: "test_middleware_abort", nodes: []*servicer.Node{{Host: "127.0.0.1", Port: 1}}}
+			servicer.SetServicer(s)
+			defer servicer.DelServicer(s)
+
+			abort := func(next http.RoundTripper) http.RoundTripper {
+				return client.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+					return nil, assert.AnError
+				})
+			}
+			err := New(WithMiddlewares(abort)).Send(context.Background(), s.name, client.Request{
+				URI:    "/test",
+				Method: http.MethodGet,
+				Codec:  json.JSONCodec{},
+			}, &client.Response{Body: &map[string]interface{}{}, Codec: json.JSONCodec{}})
+			assert.ErrorIs(t, err, assert.AnError)
+		})
+	})
+}
+
+func TestRPC_SendSign(t *testing.T) {
+	convey.Convey("TestRPC_SendSign", t, func() {
+		convey.Convey("signed and verified", func() {
+			keys := func(keyID string) ([]byte, bool) { return []byte("secret"), keyID == "caller" }
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if _, err := signature.VerifyRequest(r, keys, time.Minute); err != nil {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				_, _ = w.Write([]byte(`{"code":0}`))
+			}))
+			defer server.Close()
+
+			s := &mockServicer{
+				name:  "test_sign",
+				nodes: []*servicer.Node{newNode(t, server)},
+				sign:  signature.Config{KeyID: "caller", Secret: "secret"},
+			}
+			servicer.SetServicer(s)
+			defer servicer.DelServicer(s)
+
+			err := New().Send(context.Background(), s.name, client.Request{
+				URI:    "/test?a=1",
+				Method: http.MethodPost,
+				Body:   map[string]interface{}{"a": 1},
+				Codec:  json.JSONCodec{},
+			}, &client.Response{Body: &map[string]interface{}{}, Codec: json.JSONCodec{}})
+			assert.Nil(t, err)
+		})
+		convey.Convey("stream body unsigned", func() {
+			keys := func(keyID string) ([]byte, bool) { return []byte("secret"), keyID == "caller" }
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				v, err := signature.VerifyRequest(r, keys, time.Minute)
+				if err != nil || !v.UnsignedPayload {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				_, _ = io.Copy(w, r.Body)
+			}))
+			defer server.Close()
+
+			s := &mockServicer{
+				name:  "test_sign_stream",
+				nodes: []*servicer.Node{newNode(t, server)},
+				sign:  signature.Config{KeyID: "caller", Secret: "secret"},
+			}
+			servicer.SetServicer(s)
+			defer servicer.DelServicer(s)
+
+			// 仅可读一次的body不被缓冲
+			body, writer := io.Pipe()
+			go func() {
+				_, _ = writer.Write([]byte("stream"))
+				_ = writer.Close()
+			}()
+			response, err := New().Stream(context.Background(), s.name, client.StreamRequest{
+				URI:    "/upload",
+				Method: http.MethodPost,
+				Body:   body,
+			})
+			assert.Nil(t, err)
+			defer response.Body.Close()
+			b, _ := ioutil.ReadAll(response.Body)
+			assert.Equal(t, "stream", string(b))
+		})
+	})
+}
@@ -0,0 +1,281 @@
+// breaker is circuit breaker with closed, open and half-open state
+package breaker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultOpenSecond       = 10
+	defaultHalfOpenRequests = 1
+)
+
+type State uint8
+
+const (
+	StateClosed State = iota
+	StateHalfOpen
+	StateOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	}
+	return fmt.Sprintf("unknown state: %d", s)
+}
+
+// Config is the thresholds of breaker,
+// it is disabled when both ConsecutiveFailures and FailureRatio are zero.
+type Config struct {
+	// ConsecutiveFailures opens the breaker when consecutive failures reach it
+	ConsecutiveFailures uint32
+	// FailureRatio opens the breaker when failure ratio in IntervalSecond reaches it
+	FailureRatio float64 `validate:"min=0,max=1"`
+	// MinRequest is the min requests in IntervalSecond to calculate FailureRatio
+	MinRequest uint32
+	// IntervalSecond is the cyclic period to clear counts in closed state, zero never clears
+	IntervalSecond int `validate:"min=0"`
+	// OpenSecond is the duration of open state before half-open
+	OpenSecond int `validate:"min=0"`
+	// HalfOpenRequests is the max requests allowed in half-open state,
+	// the breaker closes when all of them succeed
+	HalfOpenRequests uint32
+	// ByNode creates breaker for every node instead of the whole service
+	ByNode bool
+}
+
+func (c Config) Enabled() bool {
+	return c.ConsecutiveFailures > 0 || c.FailureRatio > 0
+}
+
+// Counts is the requests count of current generation
+type Counts struct {
+	Requests            uint32
+	Successes           uint32
+	Failures            uint32
+	ConsecutiveFailures uint32
+}
+
+// OpenError is returned when the breaker rejects the request
+type OpenError struct {
+	Name  string
+	State State
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("circuit breaker %s is %s", e.Name, e.State)
+}
+
+// StateChangeFunc is called when the state of breaker changes
+type StateChangeFunc func(name string, from, to State)
+
+type Breaker struct {
+	lock          sync.Mutex
+	name          string
+	config        Config
+	interval      time.Duration
+	openDuration  time.Duration
+	onStateChange StateChangeFunc
+	state         State
+	generation    uint64
+	counts        Counts
+	expiry        time.Time
+}
+
+type Option func(*Breaker)
+
+func WithStateChange(f StateChangeFunc) Option {
+	return func(b *Breaker) { b.onStateChange = f }
+}
+
+func New(name string, config Config, opts ...Option) *Breaker {
+	b := &Breaker{
+		name:         name,
+		config:       config,
+		interval:     time.Duration(config.IntervalSecond) * time.Second,
+		openDuration: time.Duration(config.OpenSecond) * time.Second,
+	}
+
+	for _, o := range opts {
+		o(b)
+	}
+
+	if b.openDuration <= 0 {
+		b.openDuration = defaultOpenSecond * time.Second
+	}
+
+	if b.config.HalfOpenRequests == 0 {
+		b.config.HalfOpenRequests = defaultHalfOpenRequests
+	}
+
+	b.toNewGeneration(time.Now())
+
+	return b
+}
+
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// State returns the current state
+func (b *Breaker) State() State {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	state, _ := b.currentState(time.Now())
+	return state
+}
+
+// Counts returns the counts of current generation
+func (b *Breaker) Counts() Counts {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.counts
+}
+
+// Allow checks whether the request can be sent, *OpenError is returned if not,
+// done must be called with the request result if allowed.
+func (b *Breaker) Allow() (done func(success bool), err error) {
+	done, _, err = b.Acquire()
+	return
+}
+
+// Acquire is Allow which can release the request by release without counting success or failure,
+// such as the request aborted locally, exactly one of done and release must be called if allowed.
+func (b *Breaker) Acquire() (done func(success bool), release func(), err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := time.Now()
+	state, generation := b.currentState(now)
+
+	if state == StateOpen {
+		return nil, nil, &OpenError{Name: b.name, State: state}
+	}
+	if state == StateHalfOpen && b.counts.Requests >= b.config.HalfOpenRequests {
+		return nil, nil, &OpenError{Name: b.name, State: state}
+	}
+
+	b.counts.Requests = b.counts.Requests + 1
+
+	return func(success bool) { b.after(generation, success) }, func() { b.release(generation) }, nil
+}
+
+func (b *Breaker) release(before uint64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	_, generation := b.currentState(time.Now())
+	if generation != before || b.counts.Requests == 0 {
+		return
+	}
+	b.counts.Requests = b.counts.Requests - 1
+}
+
+func (b *Breaker) after(before uint64, success bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := time.Now()
+	state, generation := b.currentState(now)
+	// the result of last generation is discarded
+	if generation != before {
+		return
+	}
+
+	if success {
+		b.onSuccess(state, now)
+		return
+	}
+	b.onFailure(state, now)
+}
+
+func (b *Breaker) onSuccess(state State, now time.Time) {
+	b.counts.Successes = b.counts.Successes + 1
+	b.counts.ConsecutiveFailures = 0
+
+	if state == StateHalfOpen && b.counts.Successes >= b.config.HalfOpenRequests {
+		b.setState(StateClosed, now)
+	}
+}
+
+func (b *Breaker) onFailure(state State, now time.Time) {
+	b.counts.Failures = b.counts.Failures + 1
+	b.counts.ConsecutiveFailures = b.counts.ConsecutiveFailures + 1
+
+	switch state {
+	case StateClosed:
+		if b.readyToOpen() {
+			b.setState(StateOpen, now)
+		}
+	case StateHalfOpen:
+		b.setState(StateOpen, now)
+	}
+}
+
+func (b *Breaker) readyToOpen() bool {
+	c := b.counts
+	if b.config.ConsecutiveFailures > 0 && c.ConsecutiveFailures >= b.config.ConsecutiveFailures {
+		return true
+	}
+
+	return b.config.FailureRatio > 0 && c.Requests > 0 && c.Requests >= b.config.MinRequest &&
+		float64(c.Failures)/float64(c.Requests) >= b.config.FailureRatio
+}
+
+func (b *Breaker) currentState(now time.Time) (State, uint64) {
+	switch b.state {
+	case StateClosed:
+		if !b.expiry.IsZero() && b.expiry.Before(now) {
+			b.toNewGeneration(now)
+		}
+	case StateOpen:
+		if b.expiry.Before(now) {
+			b.setState(StateHalfOpen, now)
+		}
+	}
+	return b.state, b.generation
+}
+
+func (b *Breaker) setState(state State, now time.Time) {
+	if b.state == state {
+		return
+	}
+
+	prev := b.state
+	b.state = state
+
+	b.toNewGeneration(now)
+
+	if b.onStateChange != nil {
+		b.onStateChange(b.name, prev, state)
+	}
+}
+
+func (b *Breaker) toNewGeneration(now time.Time) {
+	b.generation = b.generation + 1
+	b.counts = Counts{}
+
+	var zero time.Time
+	switch b.state {
+	case StateClosed:
+		if b.interval == 0 {
+			b.expiry = zero
+		} else {
+			b.expiry = now.Add(b.interval)
+		}
+	case StateOpen:
+		b.expiry = now.Add(b.openDuration)
+	default:
+		b.expiry = zero
+	}
+}
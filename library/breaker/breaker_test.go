@@ -0,0 +1,146 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_Enabled(t *testing.T) {
+	convey.Convey("TestConfig_Enabled", t, func() {
+		convey.Convey("disabled", func() {
+			assert.Equal(t, false, Config{}.Enabled())
+		})
+		convey.Convey("enabled", func() {
+			assert.Equal(t, true, Config{ConsecutiveFailures: 1}.Enabled())
+			assert.Equal(t, true, Config{FailureRatio: 0.5}.Enabled())
+		})
+	})
+}
+
+func TestBreaker(t *testing.T) {
+	convey.Convey("TestBreaker", t, func() {
+		convey.Convey("consecutive failures", func() {
+			changes := make([]State, 0)
+			b := New("test_service", Config{ConsecutiveFailures: 2, HalfOpenRequests: 2},
+				WithStateChange(func(name string, from, to State) {
+					assert.Equal(t, "test_service", name)
+					changes = append(changes, to)
+				}))
+			b.openDuration = time.Millisecond * 10
+
+			for i := 0; i < 2; i++ {
+				done, err := b.Allow()
+				assert.Nil(t, err)
+				done(false)
+			}
+			assert.Equal(t, StateOpen, b.State())
+
+			_, err := b.Allow()
+			openErr := &OpenError{}
+			assert.Equal(t, true, errors.As(err, &openErr))
+			assert.Equal(t, StateOpen, openErr.State)
+
+			time.Sleep(time.Millisecond * 20)
+			assert.Equal(t, StateHalfOpen, b.State())
+
+			done1, err := b.Allow()
+			assert.Nil(t, err)
+			done2, err := b.Allow()
+			assert.Nil(t, err)
+			_, err = b.Allow()
+			assert.NotNil(t, err)
+
+			done1(true)
+			assert.Equal(t, StateHalfOpen, b.State())
+			done2(true)
+			assert.Equal(t, StateClosed, b.State())
+
+			assert.Equal(t, []State{StateOpen, StateHalfOpen, StateClosed}, changes)
+		})
+		convey.Convey("half-open failure", func() {
+			b := New("test_service", Config{ConsecutiveFailures: 1})
+			b.openDuration = time.Millisecond * 10
+
+			done, _ := b.Allow()
+			done(false)
+			time.Sleep(time.Millisecond * 20)
+
+			done, err := b.Allow()
+			assert.Nil(t, err)
+			done(false)
+			assert.Equal(t, StateOpen, b.State())
+		})
+		convey.Convey("failure ratio", func() {
+			b := New("test_service", Config{FailureRatio: 0.5, MinRequest: 4})
+
+			results := []bool{true, false, true}
+			for _, r := range results {
+				done, _ := b.Allow()
+				done(r)
+			}
+			assert.Equal(t, StateClosed, b.State())
+
+			done, _ := b.Allow()
+			done(false)
+			assert.Equal(t, StateOpen, b.State())
+		})
+		convey.Convey("release in half-open", func() {
+			b := New("test_service", Config{ConsecutiveFailures: 1})
+			b.openDuration = time.Millisecond * 10
+
+			done, _ := b.Allow()
+			done(false)
+			time.Sleep(time.Millisecond * 20)
+
+			_, release, err := b.Acquire()
+			assert.Nil(t, err)
+			release()
+			assert.Equal(t, StateHalfOpen, b.State())
+			assert.Equal(t, Counts{}, b.Counts())
+
+			// 释放后仍可发送探测请求
+			done, err = b.Allow()
+			assert.Nil(t, err)
+			done(true)
+			assert.Equal(t, StateClosed, b.State())
+		})
+		convey.Convey("discard result of last generation", func() {
+			b := New("test_service", Config{ConsecutiveFailures: 1})
+
+			slow, _ := b.Allow()
+			done, _ := b.Allow()
+			done(false)
+			assert.Equal(t, StateOpen, b.State())
+
+			slow(false)
+			assert.Equal(t, Counts{}, b.Counts())
+		})
+		convey.Convey("clear counts by interval", func() {
+			b := New("test_service", Config{ConsecutiveFailures: 2})
+			b.interval = time.Millisecond * 10
+			b.toNewGeneration(time.Now())
+
+			done, _ := b.Allow()
+			done(false)
+			time.Sleep(time.Millisecond * 20)
+
+			done, _ = b.Allow()
+			done(false)
+			assert.Equal(t, StateClosed, b.State())
+		})
+	})
+}
+
+func TestState_String(t *testing.T) {
+	convey.Convey("TestState_String", t, func() {
+		convey.Convey("success", func() {
+			assert.Equal(t, "closed", StateClosed.String())
+			assert.Equal(t, "half-open", StateHalfOpen.String())
+			assert.Equal(t, "open", StateOpen.String())
+		})
+	})
+}
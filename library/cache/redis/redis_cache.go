@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"reflect"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -58,8 +59,10 @@ func (rc *RedisCache) GetData(ctx context.Context, key string, ttl time.Duration
 		return
 	}
 
+	// 异步刷新使用新的data，避免与调用方并发读写
 	ctxNew := utilCtx.RemoveCancel(ctx)
-	go rc.FlushCache(ctxNew, key, ttl, virtualTTL, f, data)
+	newData := reflect.New(reflect.TypeOf(data).Elem()).Interface()
+	go rc.FlushCache(ctxNew, key, ttl, virtualTTL, f, newData)
 
 	return
 }
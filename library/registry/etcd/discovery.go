@@ -232,7 +232,8 @@ func (s *EtcdDiscovery) context() (context.Context, context.CancelFunc) {
 }
 
 func JSONDecode(val string) (*registry.Node, error) {
-	node := &registry.Node{}
+	// 未携带权重的节点使用默认权重
+	node := &registry.Node{Weight: registry.DefaultWeight}
 	err := json.Unmarshal([]byte(val), node)
 	if err != nil {
 		return nil, errors.New("Unmarshal val " + err.Error())
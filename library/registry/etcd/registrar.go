@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/why444216978/gin-api/library/registry"
 
@@ -13,15 +14,18 @@ import (
 
 // EtcdRegistrar
 type EtcdRegistrar struct {
+	lock          sync.Mutex
 	serviceName   string
 	host          string
 	port          int
+	weight        int
 	cli           *clientv3.Client
 	leaseID       clientv3.LeaseID
 	keepAliveChan <-chan *clientv3.LeaseKeepAliveResponse
 	key           string
 	val           string
 	lease         int64
+	meta          map[string]string
 	encode        registry.Encode
 }
 
@@ -49,11 +53,23 @@ func WithRegistrarLease(lease int64) RegistrarOption {
 	return func(er *EtcdRegistrar) { er.lease = lease }
 }
 
+// WithRegistrarWeight set the weight of node, registry.DefaultWeight is used if not set,
+// zero weight drains the node
+func WithRegistrarWeight(weight int) RegistrarOption {
+	return func(er *EtcdRegistrar) { er.weight = weight }
+}
+
+// WithRegistrarMeta set the labels of node, such as zone, version, canary and protocol
+func WithRegistrarMeta(meta map[string]string) RegistrarOption {
+	return func(er *EtcdRegistrar) { er.meta = meta }
+}
+
 // NewRegistry
 func NewRegistry(opts ...RegistrarOption) (*EtcdRegistrar, error) {
 	var err error
 
 	r := &EtcdRegistrar{
+		weight: registry.DefaultWeight,
 		encode: JSONEncode,
 	}
 
@@ -63,23 +79,32 @@ func NewRegistry(opts ...RegistrarOption) (*EtcdRegistrar, error) {
 
 	r.key = fmt.Sprintf("%s.%s.%d", r.serviceName, r.host, r.port)
 
-	if r.val, err = r.encode(&registry.Node{
-		Host: r.host,
-		Port: r.port,
-	}); err != nil {
+	if r.val, err = r.encode(r.node()); err != nil {
 		return nil, err
 	}
 
 	return r, nil
 }
 
+func (s *EtcdRegistrar) node() *registry.Node {
+	return &registry.Node{
+		Host:   s.host,
+		Port:   s.port,
+		Weight: s.weight,
+		Meta:   s.meta,
+	}
+}
+
 func (s *EtcdRegistrar) Register(ctx context.Context) error {
 	if s.cli == nil {
 		return errors.New("cli is nil")
 	}
 
 	// 申请租约设置时间keepalive
-	if err := s.putKeyWithRegistrarLease(ctx, s.lease); err != nil {
+	s.lock.Lock()
+	err := s.putKeyWithRegistrarLease(ctx, s.lease)
+	s.lock.Unlock()
+	if err != nil {
 		return err
 	}
 
@@ -111,6 +136,38 @@ func (s *EtcdRegistrar) putKeyWithRegistrarLease(ctx context.Context, lease int6
 	return nil
 }
 
+// UpdateWeight re-puts the node with new weight under the same lease,
+// discoveries watching the service see it, so the instance can be drained gradually
+func (s *EtcdRegistrar) UpdateWeight(ctx context.Context, weight int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.cli == nil {
+		return errors.New("cli is nil")
+	}
+
+	if s.leaseID == clientv3.NoLease {
+		return errors.New("service is not registered")
+	}
+
+	old := s.weight
+	s.weight = weight
+
+	val, err := s.encode(s.node())
+	if err != nil {
+		s.weight = old
+		return err
+	}
+
+	if _, err = s.cli.Put(ctx, s.key, val, clientv3.WithLease(s.leaseID)); err != nil {
+		s.weight = old
+		return err
+	}
+	s.val = val
+
+	return nil
+}
+
 // listenLeaseRespChan
 func (s *EtcdRegistrar) listenLeaseRespChan() {
 	for leaseKeepResp := range s.keepAliveChan {
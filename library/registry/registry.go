@@ -5,14 +5,21 @@ import (
 	"time"
 )
 
+// DefaultWeight is the weight of node when it is not set,
+// zero weight is valid and means the node gets no new requests.
+const DefaultWeight = 10
+
 type Node struct {
 	Host   string
 	Port   int
-	Weight int //TODO support service weight
+	Weight int
+	Meta   map[string]string
 }
 
 type RegistryConfig struct {
-	Lease int64
+	Lease  int64
+	Weight int
+	Meta   map[string]string
 }
 
 // Registrar is service registrar
@@ -0,0 +1,185 @@
+// retry is retry policy with exponential backoff and token bucket retry budget
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultBaseBackoffMillisecond = 10
+	defaultMaxBackoffMillisecond  = 200
+	defaultBudgetTokens           = 10
+	defaultBudgetTokenRatio       = 0.1
+)
+
+var defaultCodes = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// Config is the retry policy, it is disabled when MaxAttempts <= 1
+type Config struct {
+	// MaxAttempts is the max attempts including the first one
+	MaxAttempts int `validate:"min=0"`
+	// Codes is the retryable HTTP codes, default 502、503、504
+	Codes []int
+	// NonIdempotent allows retrying non-idempotent methods, such as POST and PATCH
+	NonIdempotent bool
+	// BaseBackoffMillisecond is the backoff of the first retry, it doubles on every retry
+	BaseBackoffMillisecond int `validate:"min=0"`
+	// MaxBackoffMillisecond is the max backoff
+	MaxBackoffMillisecond int `validate:"min=0"`
+	// BudgetTokens is the capacity of retry budget, retries are allowed when tokens > BudgetTokens/2
+	BudgetTokens float64 `validate:"min=0"`
+	// BudgetTokenRatio is the tokens returned by a success request, a failed request takes one token
+	BudgetTokenRatio float64 `validate:"min=0"`
+}
+
+func (c Config) Enabled() bool {
+	return c.MaxAttempts > 1
+}
+
+// RetryableCode checks whether the HTTP code can be retried
+func (c Config) RetryableCode(code int) bool {
+	codes := c.Codes
+	if len(codes) == 0 {
+		codes = defaultCodes
+	}
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryableMethod checks whether the method can be retried
+func (c Config) RetryableMethod(method string) bool {
+	if c.NonIdempotent {
+		return true
+	}
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// Backoff returns the backoff before the retry, retry starts from 1,
+// it is a random duration in [0, min(base*2^(retry-1), max)] as full jitter.
+func (c Config) Backoff(retry int) time.Duration {
+	base := time.Duration(c.BaseBackoffMillisecond) * time.Millisecond
+	if base <= 0 {
+		base = defaultBaseBackoffMillisecond * time.Millisecond
+	}
+	max := time.Duration(c.MaxBackoffMillisecond) * time.Millisecond
+	if max <= 0 {
+		max = defaultMaxBackoffMillisecond * time.Millisecond
+	}
+	if retry < 1 {
+		retry = 1
+	}
+
+	backoff := base << uint(retry-1)
+	if backoff <= 0 || backoff > max {
+		backoff = max
+	}
+
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
+
+// RetryableError checks whether the error can be retried, only the connect and reset failures are retried,
+// canceled or deadline exceeded request is never retried. *url.Error returned by http.Client is unwrapped,
+// so that the local errors such as TLS verification or aborted by middleware are not retried.
+func RetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return opErr.Op == "dial" || opErr.Op == "read"
+	}
+
+	return false
+}
+
+// Budget is token bucket to stop retry storms,
+// failure takes one token, success returns ratio tokens,
+// retry is allowed only when tokens are more than half of the capacity.
+type Budget struct {
+	lock   sync.Mutex
+	max    float64
+	ratio  float64
+	tokens float64
+}
+
+func NewBudget(tokens, ratio float64) *Budget {
+	if tokens <= 0 {
+		tokens = defaultBudgetTokens
+	}
+	if ratio <= 0 {
+		ratio = defaultBudgetTokenRatio
+	}
+
+	return &Budget{
+		max:    tokens,
+		ratio:  ratio,
+		tokens: tokens,
+	}
+}
+
+// Allow checks whether a retry is allowed
+func (b *Budget) Allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.tokens > b.max/2
+}
+
+func (b *Budget) OnSuccess() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.tokens = b.tokens + b.ratio
+	if b.tokens > b.max {
+		b.tokens = b.max
+	}
+}
+
+func (b *Budget) OnFailure() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.tokens = b.tokens - 1
+	if b.tokens < 0 {
+		b.tokens = 0
+	}
+}
+
+// Tokens returns the current tokens
+func (b *Budget) Tokens() float64 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.tokens
+}
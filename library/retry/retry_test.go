@@ -0,0 +1,116 @@
+package retry
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfig_RetryableCode(t *testing.T) {
+	convey.Convey("TestConfig_RetryableCode", t, func() {
+		convey.Convey("default codes", func() {
+			c := Config{}
+			assert.Equal(t, true, c.RetryableCode(http.StatusBadGateway))
+			assert.Equal(t, false, c.RetryableCode(http.StatusInternalServerError))
+			assert.Equal(t, false, c.RetryableCode(http.StatusOK))
+		})
+		convey.Convey("custom codes", func() {
+			c := Config{Codes: []int{http.StatusInternalServerError}}
+			assert.Equal(t, true, c.RetryableCode(http.StatusInternalServerError))
+			assert.Equal(t, false, c.RetryableCode(http.StatusBadGateway))
+		})
+	})
+}
+
+func TestConfig_RetryableMethod(t *testing.T) {
+	convey.Convey("TestConfig_RetryableMethod", t, func() {
+		convey.Convey("idempotent only", func() {
+			c := Config{}
+			assert.Equal(t, true, c.RetryableMethod(http.MethodGet))
+			assert.Equal(t, true, c.RetryableMethod(http.MethodPut))
+			assert.Equal(t, false, c.RetryableMethod(http.MethodPost))
+			assert.Equal(t, false, c.RetryableMethod(http.MethodPatch))
+		})
+		convey.Convey("non-idempotent", func() {
+			c := Config{NonIdempotent: true}
+			assert.Equal(t, true, c.RetryableMethod(http.MethodPost))
+		})
+	})
+}
+
+func TestConfig_Backoff(t *testing.T) {
+	convey.Convey("TestConfig_Backoff", t, func() {
+		convey.Convey("success", func() {
+			c := Config{BaseBackoffMillisecond: 10, MaxBackoffMillisecond: 30}
+			for i := 0; i < 100; i++ {
+				assert.LessOrEqual(t, int64(c.Backoff(1)), int64(10*time.Millisecond))
+				assert.LessOrEqual(t, int64(c.Backoff(2)), int64(20*time.Millisecond))
+				assert.LessOrEqual(t, int64(c.Backoff(10)), int64(30*time.Millisecond))
+				assert.GreaterOrEqual(t, int64(c.Backoff(10)), int64(0))
+			}
+		})
+	})
+}
+
+func TestRetryableError(t *testing.T) {
+	convey.Convey("TestRetryableError", t, func() {
+		convey.Convey("success", func() {
+			assert.Equal(t, false, RetryableError(nil))
+			assert.Equal(t, false, RetryableError(context.Canceled))
+			assert.Equal(t, false, RetryableError(fmt.Errorf("wrap: %w", context.DeadlineExceeded)))
+			assert.Equal(t, false, RetryableError(assert.AnError))
+			assert.Equal(t, true, RetryableError(io.EOF))
+			assert.Equal(t, true, RetryableError(fmt.Errorf("wrap: %w", syscall.ECONNREFUSED)))
+		})
+		convey.Convey("url error", func() {
+			wrap := func(err error) error { return &url.Error{Op: "Get", URL: "http://127.0.0.1", Err: err} }
+
+			// 非网络错误不重试，如中间件中断、TLS校验失败
+			assert.Equal(t, false, RetryableError(wrap(assert.AnError)))
+			assert.Equal(t, false, RetryableError(wrap(x509.UnknownAuthorityError{})))
+			assert.Equal(t, false, RetryableError(wrap(&net.OpError{Op: "write", Err: assert.AnError})))
+			assert.Equal(t, false, RetryableError(wrap(context.Canceled)))
+
+			assert.Equal(t, true, RetryableError(wrap(&net.OpError{Op: "dial", Err: syscall.ECONNREFUSED})))
+			assert.Equal(t, true, RetryableError(wrap(&net.OpError{Op: "read", Err: assert.AnError})))
+			assert.Equal(t, true, RetryableError(wrap(io.ErrUnexpectedEOF)))
+		})
+	})
+}
+
+func TestBudget(t *testing.T) {
+	convey.Convey("TestBudget", t, func() {
+		convey.Convey("stop retry storms", func() {
+			b := NewBudget(4, 0.5)
+			assert.Equal(t, true, b.Allow())
+
+			b.OnFailure()
+			assert.Equal(t, true, b.Allow())
+			b.OnFailure()
+			assert.Equal(t, false, b.Allow())
+
+			b.OnSuccess()
+			assert.Equal(t, true, b.Allow())
+
+			for i := 0; i < 10; i++ {
+				b.OnSuccess()
+			}
+			assert.Equal(t, float64(4), b.Tokens())
+
+			for i := 0; i < 10; i++ {
+				b.OnFailure()
+			}
+			assert.Equal(t, float64(0), b.Tokens())
+		})
+	})
+}
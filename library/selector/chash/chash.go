@@ -0,0 +1,315 @@
+// chash is Consistent Hash by ring with virtual nodes
+package chash
+
+import (
+	"errors"
+	"hash/crc32"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/why444216978/gin-api/library/selector"
+)
+
+const defaultReplicas = 160
+
+type Hash func(data []byte) uint32
+
+type Node struct {
+	lock       sync.RWMutex
+	address    string
+	weight     int
+	meta       selector.Meta
+	statistics selector.Statistics
+}
+
+var (
+	_ selector.Node        = (*Node)(nil)
+	_ selector.NewNodeFunc = NewNode
+)
+
+func NewNode(host string, port, weight int, meta selector.Meta) selector.Node {
+	return &Node{
+		address:    selector.GenerateAddress(host, port),
+		weight:     weight,
+		meta:       meta,
+		statistics: selector.Statistics{},
+	}
+}
+
+func (n *Node) Address() string {
+	return n.address
+}
+
+func (n *Node) Meta() selector.Meta {
+	return n.meta
+}
+
+func (n *Node) Statistics() selector.Statistics {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.statistics
+}
+
+func (n *Node) Weight() int {
+	return n.weight
+}
+
+func (n *Node) incrSuccess() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.statistics.Success = n.statistics.Success + 1
+}
+
+func (n *Node) incrFail() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.statistics.Fail = n.statistics.Fail + 1
+}
+
+type Selector struct {
+	lock        sync.RWMutex
+	nodes       map[string]*Node
+	list        []*Node
+	ring        []uint32
+	ringNodes   map[uint32]*Node
+	replicas    int
+	hash        Hash
+	serviceName string
+}
+
+var (
+	_ selector.Selector    = (*Selector)(nil)
+	_ selector.KeySelector = (*Selector)(nil)
+)
+
+type SelectorOption func(*Selector)
+
+func WithServiceName(name string) SelectorOption {
+	return func(s *Selector) { s.serviceName = name }
+}
+
+// WithReplicas set the count of virtual nodes for per weight
+func WithReplicas(replicas int) SelectorOption {
+	return func(s *Selector) { s.replicas = replicas }
+}
+
+// WithHash set the hash func, default is crc32.ChecksumIEEE
+func WithHash(hash Hash) SelectorOption {
+	return func(s *Selector) { s.hash = hash }
+}
+
+func NewSelector(opts ...SelectorOption) *Selector {
+	s := &Selector{
+		nodes:     make(map[string]*Node),
+		list:      make([]*Node, 0),
+		ring:      make([]uint32, 0),
+		ringNodes: make(map[uint32]*Node),
+		hash:      crc32.ChecksumIEEE,
+	}
+
+	for _, o := range opts {
+		o(s)
+	}
+
+	if s.replicas <= 0 {
+		s.replicas = defaultReplicas
+	}
+
+	return s
+}
+
+func (s *Selector) ServiceName() string {
+	return s.serviceName
+}
+
+// AddNode puts the virtual nodes of node into ring,
+// only the keys between the new virtual nodes and their predecessors are moved.
+func (s *Selector) AddNode(node selector.Node) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	address := node.Address()
+	if _, ok := s.nodes[address]; ok {
+		return
+	}
+
+	chashNode := s.node2CHashNode(node)
+
+	s.nodes[address] = chashNode
+	s.list = append(s.list, chashNode)
+
+	for _, h := range s.virtualHashes(chashNode) {
+		if owner, ok := s.ringNodes[h]; ok {
+			// hash冲突时地址最小的节点持有虚拟节点，与节点加入顺序无关
+			if chashNode.address < owner.address {
+				s.ringNodes[h] = chashNode
+			}
+			continue
+		}
+		s.ringNodes[h] = chashNode
+		s.ring = append(s.ring, h)
+	}
+	sort.Slice(s.ring, func(i, j int) bool { return s.ring[i] < s.ring[j] })
+
+	return
+}
+
+// DeleteNode removes the virtual nodes of node from ring,
+// only the keys on them are moved to their successors.
+func (s *Selector) DeleteNode(host string, port int) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	address := selector.GenerateAddress(host, port)
+	node, ok := s.nodes[address]
+	if !ok {
+		return
+	}
+
+	delete(s.nodes, address)
+
+	for idx, n := range s.list {
+		if n.Address() != address {
+			continue
+		}
+		s.list = append(s.list[:idx], s.list[idx+1:]...)
+		break
+	}
+
+	freed := make(map[uint32]struct{})
+	for _, h := range s.ring {
+		if s.ringNodes[h] == node {
+			delete(s.ringNodes, h)
+			freed[h] = struct{}{}
+		}
+	}
+
+	// 被删除节点持有的冲突虚拟节点交还给其余冲突节点
+	for _, n := range s.list {
+		for _, h := range s.virtualHashes(n) {
+			if _, ok := freed[h]; !ok {
+				continue
+			}
+			if owner, ok := s.ringNodes[h]; !ok || n.address < owner.address {
+				s.ringNodes[h] = n
+			}
+		}
+	}
+
+	ring := make([]uint32, 0, len(s.ringNodes))
+	for h := range s.ringNodes {
+		ring = append(ring, h)
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i] < ring[j] })
+	s.ring = ring
+
+	return
+}
+
+func (s *Selector) GetNodes() (nodes []selector.Node, err error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	nodes = make([]selector.Node, 0)
+	for _, n := range s.list {
+		nodes = append(nodes, n)
+	}
+	return
+}
+
+func (s *Selector) GetNode(host string, port int) (node selector.Node, ok bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	node, ok = s.nodes[selector.GenerateAddress(host, port)]
+	return
+}
+
+// Select returns a random node with positive weight when there is no hash key
+func (s *Selector) Select() (node selector.Node, err error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	list := make([]*Node, 0, len(s.list))
+	for _, n := range s.list {
+		if n.weight > 0 {
+			list = append(list, n)
+		}
+	}
+
+	if len(list) == 0 {
+		err = errors.New("node is nil")
+		return
+	}
+	node = list[rand.Intn(len(list))]
+
+	return
+}
+
+// SelectByKey returns the first virtual node clockwise from the hash of key
+func (s *Selector) SelectByKey(key string) (node selector.Node, err error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if len(s.ring) == 0 {
+		err = errors.New("node is nil")
+		return
+	}
+
+	h := s.hash([]byte(key))
+	idx := sort.Search(len(s.ring), func(i int) bool { return s.ring[i] >= h })
+	if idx == len(s.ring) {
+		idx = 0
+	}
+	node = s.ringNodes[s.ring[idx]]
+
+	return
+}
+
+func (s *Selector) AfterHandle(address string, err error) {
+	if selector.IsCanceled(err) {
+		return
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	node := s.nodes[address]
+	if node == nil {
+		return
+	}
+
+	if err != nil {
+		node.incrFail()
+		return
+	}
+	node.incrSuccess()
+
+	return
+}
+
+func (s *Selector) virtualHashes(n *Node) []uint32 {
+	// 权重为0的节点不放入环，不再分配新请求
+	if n.weight <= 0 {
+		return nil
+	}
+
+	count := s.replicas * n.weight
+	hashes := make([]uint32, 0, count)
+	for i := 0; i < count; i++ {
+		hashes = append(hashes, s.hash([]byte(n.address+"#"+strconv.Itoa(i))))
+	}
+
+	return hashes
+}
+
+func (s *Selector) node2CHashNode(node selector.Node) *Node {
+	return &Node{
+		address:    node.Address(),
+		weight:     node.Weight(),
+		meta:       node.Meta(),
+		statistics: node.Statistics(),
+	}
+}
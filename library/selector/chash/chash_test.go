@@ -0,0 +1,181 @@
+package chash
+
+import (
+	"hash/crc32"
+	"strconv"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/why444216978/gin-api/library/selector"
+)
+
+func TestNewNode(t *testing.T) {
+	convey.Convey("TestNewNode", t, func() {
+		convey.Convey("success", func() {
+			ip := "127.0.0.1"
+			port := 80
+			weight := 10
+			meta := selector.Meta{}
+			node := NewNode(ip, port, weight, meta)
+			assert.Equal(t, node.Address(), selector.GenerateAddress(ip, port))
+			assert.Equal(t, node.Weight(), weight)
+			assert.Equal(t, node.Meta(), meta)
+		})
+	})
+}
+
+func TestSelector_Select(t *testing.T) {
+	convey.Convey("TestSelector_Select", t, func() {
+		convey.Convey("empty", func() {
+			s := NewSelector()
+			node, err := s.Select()
+			assert.Nil(t, node)
+			assert.NotNil(t, err)
+		})
+		convey.Convey("zero weight", func() {
+			s := NewSelector()
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 0, selector.Meta{}))
+			_ = s.AddNode(NewNode("127.0.0.2", 80, 1, selector.Meta{}))
+
+			for i := 0; i < 10; i++ {
+				node, err := s.Select()
+				assert.Nil(t, err)
+				assert.Equal(t, "127.0.0.2:80", node.Address())
+			}
+
+			_ = s.DeleteNode("127.0.0.2", 80)
+			node, err := s.Select()
+			assert.Nil(t, node)
+			assert.NotNil(t, err)
+		})
+		convey.Convey("success", func() {
+			s := NewSelector()
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 1, selector.Meta{}))
+			node, err := s.Select()
+			assert.Nil(t, err)
+			assert.Equal(t, "127.0.0.1:80", node.Address())
+		})
+	})
+}
+
+func TestSelector_SelectByKey(t *testing.T) {
+	convey.Convey("TestSelector_SelectByKey", t, func() {
+		convey.Convey("empty", func() {
+			s := NewSelector()
+			node, err := s.SelectByKey("key")
+			assert.Nil(t, node)
+			assert.NotNil(t, err)
+		})
+		convey.Convey("zero weight", func() {
+			s := NewSelector()
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 0, selector.Meta{}))
+			_ = s.AddNode(NewNode("127.0.0.2", 80, 1, selector.Meta{}))
+
+			for i := 0; i < 10; i++ {
+				node, err := s.SelectByKey(strconv.Itoa(i))
+				assert.Nil(t, err)
+				assert.Equal(t, "127.0.0.2:80", node.Address())
+			}
+		})
+		convey.Convey("same key same node", func() {
+			s := NewSelector()
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 1, selector.Meta{}))
+			_ = s.AddNode(NewNode("127.0.0.2", 80, 1, selector.Meta{}))
+			_ = s.AddNode(NewNode("127.0.0.3", 80, 1, selector.Meta{}))
+
+			first, err := s.SelectByKey("user_1")
+			assert.Nil(t, err)
+			for i := 0; i < 10; i++ {
+				node, _ := s.SelectByKey("user_1")
+				assert.Equal(t, first.Address(), node.Address())
+			}
+		})
+		convey.Convey("minimal rebalance", func() {
+			s := NewSelector()
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 1, selector.Meta{}))
+			_ = s.AddNode(NewNode("127.0.0.2", 80, 1, selector.Meta{}))
+			_ = s.AddNode(NewNode("127.0.0.3", 80, 1, selector.Meta{}))
+
+			keys := 10000
+			before := selectKeys(s, keys)
+
+			// add node, only keys moved to the new node
+			_ = s.AddNode(NewNode("127.0.0.4", 80, 1, selector.Meta{}))
+			added := selectKeys(s, keys)
+			moved := 0
+			for i := 0; i < keys; i++ {
+				if before[i] == added[i] {
+					continue
+				}
+				moved++
+				assert.Equal(t, "127.0.0.4:80", added[i])
+			}
+			assert.Greater(t, moved, keys/8)
+			assert.Less(t, moved, keys/2)
+
+			// delete node, only keys on the deleted node moved
+			_ = s.DeleteNode("127.0.0.4", 80)
+			deleted := selectKeys(s, keys)
+			assert.Equal(t, before, deleted)
+
+			_ = s.DeleteNode("127.0.0.2", 80)
+			deleted = selectKeys(s, keys)
+			for i := 0; i < keys; i++ {
+				if before[i] != "127.0.0.2:80" {
+					assert.Equal(t, before[i], deleted[i])
+				}
+			}
+		})
+		convey.Convey("hash collision", func() {
+			// 小hash空间制造大量虚拟节点冲突
+			hash := func(data []byte) uint32 { return crc32.ChecksumIEEE(data) % 64 }
+			newSelector := func(hosts ...string) *Selector {
+				s := NewSelector(WithHash(hash), WithReplicas(16))
+				for _, host := range hosts {
+					_ = s.AddNode(NewNode(host, 80, 1, selector.Meta{}))
+				}
+				return s
+			}
+
+			keys := 1000
+			expected := selectKeys(newSelector("127.0.0.1", "127.0.0.2", "127.0.0.3"), keys)
+
+			// 与节点加入顺序无关
+			assert.Equal(t, expected, selectKeys(newSelector("127.0.0.3", "127.0.0.2", "127.0.0.1"), keys))
+			assert.Equal(t, expected, selectKeys(newSelector("127.0.0.2", "127.0.0.3", "127.0.0.1"), keys))
+
+			// 删除后冲突的虚拟节点交还给其余节点
+			s := newSelector("127.0.0.1", "127.0.0.4", "127.0.0.2", "127.0.0.3")
+			_ = s.DeleteNode("127.0.0.4", 80)
+			assert.Equal(t, expected, selectKeys(s, keys))
+			_ = s.DeleteNode("127.0.0.1", 80)
+			assert.Equal(t, selectKeys(newSelector("127.0.0.2", "127.0.0.3"), keys), selectKeys(s, keys))
+		})
+	})
+}
+
+func TestSelector_AfterHandle(t *testing.T) {
+	convey.Convey("TestSelector_AfterHandle", t, func() {
+		convey.Convey("success", func() {
+			s := NewSelector()
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 1, selector.Meta{}))
+
+			s.AfterHandle("127.0.0.1:80", nil)
+			s.AfterHandle("127.0.0.1:80", assert.AnError)
+
+			node, _ := s.GetNode("127.0.0.1", 80)
+			assert.Equal(t, selector.Statistics{Success: 1, Fail: 1}, node.Statistics())
+		})
+	})
+}
+
+func selectKeys(s *Selector, count int) []string {
+	res := make([]string, count)
+	for i := 0; i < count; i++ {
+		node, _ := s.SelectByKey("user_" + strconv.Itoa(i))
+		res[i] = node.Address()
+	}
+	return res
+}
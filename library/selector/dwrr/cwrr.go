@@ -1,100 +1,288 @@
 // dwrr is Dynamic Weighted Round Robin
 package dwrr
 
-// import (
-// 	"math"
-// 	"sync"
+import (
+	"errors"
+	"math"
+	"sync"
 
-// 	"github.com/why444216978/gin-api/library/selector"
-// )
+	"github.com/why444216978/gin-api/library/selector"
+)
 
-// const defaultStep float64 = 0.1
+const (
+	defaultStep  float64 = 0.1
+	defaultFloor float64 = 0.1
+)
 
-// type Node struct {
-// 	lock          sync.RWMutex
-// 	address       string
-// 	weight        float64
-// 	currentWeight float64
-// 	meta          selector.Meta
-// 	statistics    selector.Statistics
-// }
+type Node struct {
+	lock            sync.RWMutex
+	address         string
+	weight          int
+	effectiveWeight float64
+	currentWeight   float64
+	meta            selector.Meta
+	statistics      selector.Statistics
+}
 
-// var _ selector.Node = (*Node)(nil)
+var (
+	_ selector.Node        = (*Node)(nil)
+	_ selector.NewNodeFunc = NewNode
+)
 
-// func (n *Node) Address() string {
-// 	return n.address
-// }
+func NewNode(host string, port, weight int, meta selector.Meta) selector.Node {
+	return &Node{
+		address:         selector.GenerateAddress(host, port),
+		weight:          weight,
+		effectiveWeight: float64(weight),
+		meta:            meta,
+		statistics:      selector.Statistics{},
+	}
+}
 
-// func (n *Node) Meta() selector.Meta {
-// 	return n.meta
-// }
+func (n *Node) Address() string {
+	return n.address
+}
 
-// func (n *Node) Statistics() selector.Statistics {
-// 	n.lock.RLock()
-// 	defer n.lock.RUnlock()
-// 	return n.statistics
-// }
+func (n *Node) Meta() selector.Meta {
+	return n.meta
+}
 
-// func (n *Node) Weight() float64 {
-// 	return n.weight
-// }
+func (n *Node) Statistics() selector.Statistics {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.statistics
+}
 
-// type Selector struct {
-// 	lock        sync.RWMutex
-// 	nodeCount   int
-// 	nodes       map[string]*Node
-// 	list        []*Node
-// 	step        float64
-// 	serviceName string
-// }
+func (n *Node) Weight() int {
+	return n.weight
+}
 
-// var _ selector.Selector = (*Selector)(nil)
+// EffectiveWeight returns the weight adjusted by the request results
+func (n *Node) EffectiveWeight() float64 {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.effectiveWeight
+}
 
-// type SelectorOption func(*Selector)
+func (n *Node) incrSuccess() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.statistics.Success = n.statistics.Success + 1
+}
 
-// func WithServiceName(name string) SelectorOption {
-// 	return func(s *Selector) { s.serviceName = name }
-// }
+func (n *Node) incrFail() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.statistics.Fail = n.statistics.Fail + 1
+}
 
-// func WithStep(step float64) SelectorOption {
-// 	return func(s *Selector) { s.step = step }
-// }
+type Selector struct {
+	lock        sync.Mutex
+	nodes       map[string]*Node
+	list        []*Node
+	step        float64
+	floor       float64
+	serviceName string
+}
 
-// func NewSelector(opts ...SelectorOption) *Selector {
-// 	s := &Selector{
-// 		nodes: make(map[string]*Node),
-// 		list:  make([]*Node, 0),
-// 	}
+var _ selector.Selector = (*Selector)(nil)
 
-// 	for _, o := range opts {
-// 		o(s)
-// 	}
+type SelectorOption func(*Selector)
 
-// 	if s.step <= 0 {
-// 		s.step = defaultStep
-// 	}
+func WithServiceName(name string) SelectorOption {
+	return func(s *Selector) { s.serviceName = name }
+}
 
-// 	return s
-// }
+// WithStep set the ratio that effective weight changes by on every request result
+func WithStep(step float64) SelectorOption {
+	return func(s *Selector) { s.step = step }
+}
 
-// func (s *Selector) incrWeight(n *Node) {
-// 	n.lock.Lock()
-// 	defer n.lock.Unlock()
+// WithFloor set the min ratio of effective weight to configured weight
+func WithFloor(floor float64) SelectorOption {
+	return func(s *Selector) { s.floor = floor }
+}
 
-// 	n.currentWeight = math.Trunc(n.currentWeight*(1+s.step)*1e2+0.5) * 1e-2
+func NewSelector(opts ...SelectorOption) *Selector {
+	s := &Selector{
+		nodes: make(map[string]*Node),
+		list:  make([]*Node, 0),
+	}
 
-// 	if n.currentWeight > n.weight {
-// 		n.currentWeight = n.weight
-// 	}
+	for _, o := range opts {
+		o(s)
+	}
 
-// 	return
-// }
+	if s.step <= 0 || s.step >= 1 {
+		s.step = defaultStep
+	}
 
-// func (s *Selector) decreaseWeight(n *Node) {
-// 	n.lock.Lock()
-// 	defer n.lock.Unlock()
+	if s.floor <= 0 || s.floor > 1 {
+		s.floor = defaultFloor
+	}
 
-// 	n.currentWeight = math.Trunc(n.currentWeight*(1-s.step)*1e2+0.5) * 1e-2
+	return s
+}
 
-// 	return
-// }
+func (s *Selector) ServiceName() string {
+	return s.serviceName
+}
+
+func (s *Selector) AddNode(node selector.Node) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	address := node.Address()
+	if _, ok := s.nodes[address]; ok {
+		return
+	}
+
+	dwrrNode := s.node2DWRRNode(node)
+
+	s.nodes[address] = dwrrNode
+	s.list = append(s.list, dwrrNode)
+
+	return
+}
+
+func (s *Selector) DeleteNode(host string, port int) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	address := selector.GenerateAddress(host, port)
+	if _, ok := s.nodes[address]; !ok {
+		return
+	}
+
+	delete(s.nodes, address)
+
+	for idx, n := range s.list {
+		if n.Address() != address {
+			continue
+		}
+		s.list = append(s.list[:idx], s.list[idx+1:]...)
+		break
+	}
+
+	for _, n := range s.list {
+		n.currentWeight = 0
+	}
+
+	return
+}
+
+func (s *Selector) GetNodes() (nodes []selector.Node, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	nodes = make([]selector.Node, 0)
+	for _, n := range s.list {
+		nodes = append(nodes, n)
+	}
+	return
+}
+
+func (s *Selector) GetNode(host string, port int) (node selector.Node, ok bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	node, ok = s.nodes[selector.GenerateAddress(host, port)]
+	return
+}
+
+// Select is smooth weighted round robin by effective weight
+func (s *Selector) Select() (node selector.Node, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var (
+		best        *Node
+		totalWeight float64
+	)
+
+	for _, n := range s.list {
+		// 配置权重为0的节点不再分配新请求
+		if n.weight <= 0 {
+			continue
+		}
+		effectiveWeight := n.EffectiveWeight()
+		n.currentWeight = n.currentWeight + effectiveWeight
+		totalWeight = totalWeight + effectiveWeight
+
+		if best == nil || n.currentWeight > best.currentWeight {
+			best = n
+		}
+	}
+
+	if best == nil {
+		err = errors.New("node is nil")
+		return
+	}
+
+	best.currentWeight = best.currentWeight - totalWeight
+	node = best
+
+	return
+}
+
+func (s *Selector) AfterHandle(address string, err error) {
+	if selector.IsCanceled(err) {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	node := s.nodes[address]
+	if node == nil {
+		return
+	}
+
+	if err != nil {
+		node.incrFail()
+		s.decreaseWeight(node)
+		return
+	}
+	node.incrSuccess()
+	s.incrWeight(node)
+
+	return
+}
+
+// incrWeight recovers effective weight toward configured weight by step of the gap,
+// so a node keeps a low weight if its failures are frequent
+func (s *Selector) incrWeight(n *Node) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	weight := float64(n.weight)
+	n.effectiveWeight = math.Min(n.effectiveWeight+(weight-n.effectiveWeight)*s.step, weight)
+
+	return
+}
+
+// decreaseWeight shrinks effective weight by step of configured weight, not lower than floor
+func (s *Selector) decreaseWeight(n *Node) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	weight := float64(n.weight)
+	n.effectiveWeight = math.Max(n.effectiveWeight-weight*s.step, weight*s.floor)
+
+	return
+}
+
+func (s *Selector) node2DWRRNode(node selector.Node) *Node {
+	weight := node.Weight()
+	if weight < 0 {
+		weight = 0
+	}
+
+	return &Node{
+		address:         node.Address(),
+		weight:          weight,
+		effectiveWeight: float64(weight),
+		meta:            node.Meta(),
+		statistics:      node.Statistics(),
+	}
+}
@@ -0,0 +1,148 @@
+package dwrr
+
+import (
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/why444216978/gin-api/library/selector"
+)
+
+func TestNewNode(t *testing.T) {
+	convey.Convey("TestNewNode", t, func() {
+		convey.Convey("success", func() {
+			ip := "127.0.0.1"
+			port := 80
+			weight := 10
+			meta := selector.Meta{}
+			node := NewNode(ip, port, weight, meta)
+			assert.Equal(t, node.Address(), selector.GenerateAddress(ip, port))
+			assert.Equal(t, node.Weight(), weight)
+			assert.Equal(t, node.Meta(), meta)
+			assert.Equal(t, float64(weight), node.(*Node).EffectiveWeight())
+		})
+	})
+}
+
+func TestNewSelector(t *testing.T) {
+	convey.Convey("TestNewSelector", t, func() {
+		convey.Convey("default", func() {
+			s := NewSelector(WithStep(2), WithFloor(-1))
+			assert.Equal(t, defaultStep, s.step)
+			assert.Equal(t, defaultFloor, s.floor)
+		})
+		convey.Convey("custom", func() {
+			s := NewSelector(WithServiceName("test_service"), WithStep(0.2), WithFloor(0.3))
+			assert.Equal(t, "test_service", s.ServiceName())
+			assert.Equal(t, 0.2, s.step)
+			assert.Equal(t, 0.3, s.floor)
+		})
+	})
+}
+
+func TestSelector_Select(t *testing.T) {
+	convey.Convey("TestSelector_Select", t, func() {
+		convey.Convey("empty", func() {
+			s := NewSelector()
+			node, err := s.Select()
+			assert.Nil(t, node)
+			assert.NotNil(t, err)
+		})
+		convey.Convey("zero weight", func() {
+			s := NewSelector()
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 0, selector.Meta{}))
+			_ = s.AddNode(NewNode("127.0.0.2", 80, 1, selector.Meta{}))
+
+			for i := 0; i < 10; i++ {
+				node, err := s.Select()
+				assert.Nil(t, err)
+				assert.Equal(t, "127.0.0.2:80", node.Address())
+			}
+
+			_ = s.DeleteNode("127.0.0.2", 80)
+			node, err := s.Select()
+			assert.Nil(t, node)
+			assert.NotNil(t, err)
+		})
+		convey.Convey("smooth", func() {
+			s := NewSelector()
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 5, selector.Meta{}))
+			_ = s.AddNode(NewNode("127.0.0.2", 80, 1, selector.Meta{}))
+			_ = s.AddNode(NewNode("127.0.0.3", 80, 1, selector.Meta{}))
+
+			expect := []string{
+				"127.0.0.1:80", "127.0.0.1:80", "127.0.0.2:80", "127.0.0.1:80",
+				"127.0.0.3:80", "127.0.0.1:80", "127.0.0.1:80",
+			}
+			for _, address := range expect {
+				node, err := s.Select()
+				assert.Nil(t, err)
+				assert.Equal(t, address, node.Address())
+			}
+		})
+		convey.Convey("soft eject failed node", func() {
+			s := NewSelector(WithStep(0.5), WithFloor(0.1))
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 10, selector.Meta{}))
+			_ = s.AddNode(NewNode("127.0.0.2", 80, 10, selector.Meta{}))
+
+			for i := 0; i < 5; i++ {
+				s.AfterHandle("127.0.0.2:80", assert.AnError)
+			}
+
+			res := map[string]int{}
+			for i := 0; i < 110; i++ {
+				node, _ := s.Select()
+				res[node.Address()]++
+			}
+			assert.Equal(t, 100, res["127.0.0.1:80"])
+			assert.Equal(t, 10, res["127.0.0.2:80"])
+		})
+	})
+}
+
+func TestSelector_AfterHandle(t *testing.T) {
+	convey.Convey("TestSelector_AfterHandle", t, func() {
+		convey.Convey("decrease to floor and recover", func() {
+			s := NewSelector(WithStep(0.5), WithFloor(0.2))
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 10, selector.Meta{}))
+			n, _ := s.GetNode("127.0.0.1", 80)
+			node := n.(*Node)
+
+			s.AfterHandle("127.0.0.1:80", assert.AnError)
+			assert.Equal(t, float64(5), node.EffectiveWeight())
+
+			s.AfterHandle("127.0.0.1:80", assert.AnError)
+			assert.Equal(t, float64(2), node.EffectiveWeight())
+
+			s.AfterHandle("127.0.0.1:80", nil)
+			assert.Equal(t, float64(6), node.EffectiveWeight())
+
+			for i := 0; i < 100; i++ {
+				s.AfterHandle("127.0.0.1:80", nil)
+			}
+			assert.InDelta(t, float64(10), node.EffectiveWeight(), 0.01)
+			assert.LessOrEqual(t, node.EffectiveWeight(), float64(10))
+			assert.Equal(t, selector.Statistics{Success: 101, Fail: 2}, node.Statistics())
+		})
+	})
+}
+
+func TestSelector_DeleteNode(t *testing.T) {
+	convey.Convey("TestSelector_DeleteNode", t, func() {
+		convey.Convey("success", func() {
+			s := NewSelector()
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 1, selector.Meta{}))
+			_ = s.AddNode(NewNode("127.0.0.2", 80, 1, selector.Meta{}))
+
+			_ = s.DeleteNode("127.0.0.2", 80)
+			nodes, _ := s.GetNodes()
+			assert.Len(t, nodes, 1)
+
+			for i := 0; i < 10; i++ {
+				node, _ := s.Select()
+				assert.Equal(t, "127.0.0.1:80", node.Address())
+			}
+		})
+	})
+}
@@ -1,2 +1,305 @@
 // icmp is load balance by ping rtt
 package icmp
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/why444216978/gin-api/library/selector"
+)
+
+const (
+	defaultInterval = time.Second * 5
+	defaultTimeout  = time.Second
+)
+
+type Node struct {
+	lock       sync.RWMutex
+	address    string
+	weight     int
+	meta       selector.Meta
+	statistics selector.Statistics
+	rtt        time.Duration
+	healthy    bool
+	probed     bool
+	stop       chan struct{}
+}
+
+var (
+	_ selector.Node        = (*Node)(nil)
+	_ selector.NewNodeFunc = NewNode
+)
+
+func NewNode(host string, port, weight int, meta selector.Meta) selector.Node {
+	return &Node{
+		address:    selector.GenerateAddress(host, port),
+		weight:     weight,
+		meta:       meta,
+		statistics: selector.Statistics{},
+		healthy:    true,
+	}
+}
+
+func (n *Node) Address() string {
+	return n.address
+}
+
+func (n *Node) Meta() selector.Meta {
+	return n.meta
+}
+
+func (n *Node) Statistics() selector.Statistics {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.statistics
+}
+
+func (n *Node) Weight() int {
+	return n.weight
+}
+
+// RTT returns the round trip time of the last successful probe
+func (n *Node) RTT() time.Duration {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.rtt
+}
+
+// Healthy returns whether the last probe succeeded, node not probed yet is healthy
+func (n *Node) Healthy() bool {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.healthy
+}
+
+func (n *Node) incrSuccess() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.statistics.Success = n.statistics.Success + 1
+}
+
+func (n *Node) incrFail() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.statistics.Fail = n.statistics.Fail + 1
+}
+
+func (n *Node) setProbe(rtt time.Duration, err error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.probed = true
+	n.healthy = err == nil
+	if err == nil {
+		n.rtt = rtt
+	}
+}
+
+// less reports whether n is better than other, probed node is better than not probed one
+func (n *Node) less(other *Node) bool {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	other.lock.RLock()
+	defer other.lock.RUnlock()
+
+	if n.probed != other.probed {
+		return n.probed
+	}
+	return n.rtt < other.rtt
+}
+
+type Selector struct {
+	lock        sync.RWMutex
+	nodes       map[string]*Node
+	list        []*Node
+	interval    time.Duration
+	timeout     time.Duration
+	probe       ProbeFunc
+	serviceName string
+}
+
+var _ selector.Selector = (*Selector)(nil)
+
+type SelectorOption func(*Selector)
+
+func WithServiceName(name string) SelectorOption {
+	return func(s *Selector) { s.serviceName = name }
+}
+
+// WithInterval set the duration between two probes of a node
+func WithInterval(interval time.Duration) SelectorOption {
+	return func(s *Selector) { s.interval = interval }
+}
+
+// WithTimeout set the timeout of a single probe
+func WithTimeout(timeout time.Duration) SelectorOption {
+	return func(s *Selector) { s.timeout = timeout }
+}
+
+// WithProbe set the probe func, default is DefaultProbe
+func WithProbe(probe ProbeFunc) SelectorOption {
+	return func(s *Selector) { s.probe = probe }
+}
+
+func NewSelector(opts ...SelectorOption) *Selector {
+	s := &Selector{
+		nodes: make(map[string]*Node),
+		list:  make([]*Node, 0),
+		probe: DefaultProbe,
+	}
+
+	for _, o := range opts {
+		o(s)
+	}
+
+	if s.interval <= 0 {
+		s.interval = defaultInterval
+	}
+
+	if s.timeout <= 0 {
+		s.timeout = defaultTimeout
+	}
+
+	return s
+}
+
+func (s *Selector) ServiceName() string {
+	return s.serviceName
+}
+
+func (s *Selector) AddNode(node selector.Node) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	address := node.Address()
+	if _, ok := s.nodes[address]; ok {
+		return
+	}
+
+	icmpNode := s.node2ICMPNode(node)
+
+	s.nodes[address] = icmpNode
+	s.list = append(s.list, icmpNode)
+
+	go s.watch(icmpNode)
+
+	return
+}
+
+func (s *Selector) DeleteNode(host string, port int) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	address := selector.GenerateAddress(host, port)
+	node, ok := s.nodes[address]
+	if !ok {
+		return
+	}
+
+	close(node.stop)
+	delete(s.nodes, address)
+
+	for idx, n := range s.list {
+		if n.Address() != address {
+			continue
+		}
+		s.list = append(s.list[:idx], s.list[idx+1:]...)
+		break
+	}
+
+	return
+}
+
+func (s *Selector) GetNodes() (nodes []selector.Node, err error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	nodes = make([]selector.Node, 0)
+	for _, n := range s.list {
+		nodes = append(nodes, n)
+	}
+	return
+}
+
+func (s *Selector) GetNode(host string, port int) (node selector.Node, ok bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	node, ok = s.nodes[selector.GenerateAddress(host, port)]
+	return
+}
+
+// Select returns the healthy node with the lowest rtt
+func (s *Selector) Select() (node selector.Node, err error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	var best *Node
+	for _, n := range s.list {
+		// 权重为0的节点不再分配新请求
+		if !n.Healthy() || n.weight <= 0 {
+			continue
+		}
+		if best == nil || n.less(best) {
+			best = n
+		}
+	}
+
+	if best == nil {
+		err = errors.New("no healthy node")
+		return
+	}
+	node = best
+
+	return
+}
+
+func (s *Selector) AfterHandle(address string, err error) {
+	if selector.IsCanceled(err) {
+		return
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	node := s.nodes[address]
+	if node == nil {
+		return
+	}
+
+	if err != nil {
+		node.incrFail()
+		return
+	}
+	node.incrSuccess()
+
+	return
+}
+
+// watch probes the node periodically until it is deleted
+func (s *Selector) watch(n *Node) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		n.setProbe(s.probe(n.address, s.timeout))
+
+		select {
+		case <-n.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Selector) node2ICMPNode(node selector.Node) *Node {
+	return &Node{
+		address:    node.Address(),
+		weight:     node.Weight(),
+		meta:       node.Meta(),
+		statistics: node.Statistics(),
+		healthy:    true,
+		stop:       make(chan struct{}),
+	}
+}
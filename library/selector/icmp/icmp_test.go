@@ -0,0 +1,185 @@
+package icmp
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/why444216978/gin-api/library/selector"
+)
+
+type mockProbe struct {
+	lock  sync.Mutex
+	rtt   map[string]time.Duration
+	count map[string]int
+}
+
+func newMockProbe(rtt map[string]time.Duration) *mockProbe {
+	return &mockProbe{rtt: rtt, count: map[string]int{}}
+}
+
+func (m *mockProbe) probe(address string, timeout time.Duration) (time.Duration, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.count[address]++
+	rtt, ok := m.rtt[address]
+	if !ok {
+		return 0, errors.New("unreachable")
+	}
+	return rtt, nil
+}
+
+func (m *mockProbe) getCount(address string) int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.count[address]
+}
+
+func TestNewNode(t *testing.T) {
+	convey.Convey("TestNewNode", t, func() {
+		convey.Convey("success", func() {
+			ip := "127.0.0.1"
+			port := 80
+			weight := 10
+			meta := selector.Meta{}
+			node := NewNode(ip, port, weight, meta)
+			assert.Equal(t, node.Address(), selector.GenerateAddress(ip, port))
+			assert.Equal(t, node.Weight(), weight)
+			assert.Equal(t, node.Meta(), meta)
+			assert.Equal(t, true, node.(*Node).Healthy())
+		})
+	})
+}
+
+func TestSelector_Select(t *testing.T) {
+	convey.Convey("TestSelector_Select", t, func() {
+		convey.Convey("empty", func() {
+			s := NewSelector()
+			node, err := s.Select()
+			assert.Nil(t, node)
+			assert.NotNil(t, err)
+		})
+		convey.Convey("lowest rtt healthy node", func() {
+			m := newMockProbe(map[string]time.Duration{
+				"127.0.0.1:80": time.Millisecond * 3,
+				"127.0.0.2:80": time.Millisecond,
+			})
+			s := NewSelector(WithProbe(m.probe), WithInterval(time.Millisecond))
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 1, selector.Meta{}))
+			_ = s.AddNode(NewNode("127.0.0.2", 80, 1, selector.Meta{}))
+			_ = s.AddNode(NewNode("127.0.0.3", 80, 1, selector.Meta{}))
+
+			time.Sleep(time.Millisecond * 20)
+
+			node, err := s.Select()
+			assert.Nil(t, err)
+			assert.Equal(t, "127.0.0.2:80", node.Address())
+
+			n, _ := s.GetNode("127.0.0.3", 80)
+			assert.Equal(t, false, n.(*Node).Healthy())
+		})
+		convey.Convey("no healthy node", func() {
+			m := newMockProbe(map[string]time.Duration{})
+			s := NewSelector(WithProbe(m.probe), WithInterval(time.Millisecond))
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 1, selector.Meta{}))
+
+			time.Sleep(time.Millisecond * 20)
+
+			node, err := s.Select()
+			assert.Nil(t, node)
+			assert.NotNil(t, err)
+		})
+	})
+}
+
+func TestSelector_DeleteNode(t *testing.T) {
+	convey.Convey("TestSelector_DeleteNode", t, func() {
+		convey.Convey("stop prober", func() {
+			m := newMockProbe(map[string]time.Duration{"127.0.0.1:80": time.Millisecond})
+			s := NewSelector(WithProbe(m.probe), WithInterval(time.Millisecond))
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 1, selector.Meta{}))
+
+			time.Sleep(time.Millisecond * 10)
+			_ = s.DeleteNode("127.0.0.1", 80)
+			time.Sleep(time.Millisecond * 5)
+
+			count := m.getCount("127.0.0.1:80")
+			time.Sleep(time.Millisecond * 20)
+			assert.Equal(t, count, m.getCount("127.0.0.1:80"))
+
+			nodes, _ := s.GetNodes()
+			assert.Len(t, nodes, 0)
+		})
+	})
+}
+
+func TestTCPProbe(t *testing.T) {
+	convey.Convey("TestTCPProbe", t, func() {
+		convey.Convey("success", func() {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.Nil(t, err)
+			defer l.Close()
+
+			_, err = TCPProbe(l.Addr().String(), time.Second)
+			assert.Nil(t, err)
+		})
+		convey.Convey("refused", func() {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.Nil(t, err)
+			address := l.Addr().String()
+			l.Close()
+
+			_, err = TCPProbe(address, time.Second)
+			assert.NotNil(t, err)
+		})
+	})
+}
+
+func TestDefaultProbe(t *testing.T) {
+	convey.Convey("TestDefaultProbe", t, func() {
+		convey.Convey("fallback to tcp", func() {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.Nil(t, err)
+			defer l.Close()
+
+			_, err = DefaultProbe(l.Addr().String(), time.Millisecond*100)
+			assert.Nil(t, err)
+		})
+		convey.Convey("service port closed", func() {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.Nil(t, err)
+			address := l.Addr().String()
+			_ = l.Close()
+
+			// 主机可能回复ICMP，但服务端口未监听仍为不健康
+			_, err = DefaultProbe(address, time.Millisecond*100)
+			assert.NotNil(t, err)
+		})
+	})
+}
+
+func TestMarshalEcho(t *testing.T) {
+	convey.Convey("TestMarshalEcho", t, func() {
+		convey.Convey("success", func() {
+			b := marshalEcho(icmpTypeEcho, 1, 2, []byte("abc"))
+			assert.Equal(t, uint16(0), checksum(b))
+
+			typ, id, seq, data, ok := parseEcho(b)
+			assert.Equal(t, true, ok)
+			assert.Equal(t, icmpTypeEcho, typ)
+			assert.Equal(t, uint16(1), id)
+			assert.Equal(t, uint16(2), seq)
+			assert.Equal(t, []byte("abc"), data)
+		})
+		convey.Convey("too short", func() {
+			_, _, _, _, ok := parseEcho([]byte{0})
+			assert.Equal(t, false, ok)
+		})
+	})
+}
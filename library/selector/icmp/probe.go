@@ -0,0 +1,132 @@
+package icmp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/why444216978/gin-api/library/selector"
+)
+
+const (
+	icmpTypeEchoReply uint8 = 0
+	icmpTypeEcho      uint8 = 8
+)
+
+var (
+	echoSeq  uint32
+	echoData = []byte("gin-api-probe")
+)
+
+// ProbeFunc probes the address and returns the round trip time
+type ProbeFunc func(address string, timeout time.Duration) (rtt time.Duration, err error)
+
+// DefaultProbe checks the health of service port by TCP connect, the rtt is ICMP echo
+// when it is available, otherwise the time of TCP handshake.
+// A host replying ICMP echo without listening on the service port is unhealthy.
+func DefaultProbe(address string, timeout time.Duration) (time.Duration, error) {
+	rtt, err := TCPProbe(address, timeout)
+	if err != nil {
+		return 0, err
+	}
+	if icmpRTT, err := ICMPProbe(address, timeout); err == nil {
+		return icmpRTT, nil
+	}
+	return rtt, nil
+}
+
+// TCPProbe measures the time of TCP handshake
+func TCPProbe(address string, timeout time.Duration) (time.Duration, error) {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return 0, err
+	}
+	rtt := time.Since(start)
+	_ = conn.Close()
+
+	return rtt, nil
+}
+
+// ICMPProbe sends an ICMP echo to the host of address and waits for the reply,
+// raw socket needs privileges, so it returns error directly when it can't be opened.
+func ICMPProbe(address string, timeout time.Duration) (time.Duration, error) {
+	host, _ := selector.ExtractAddress(address)
+	ip, err := net.ResolveIPAddr("ip4", host)
+	if err != nil {
+		return 0, err
+	}
+
+	conn, err := net.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	var (
+		id  = uint16(os.Getpid() & 0xffff)
+		seq = uint16(atomic.AddUint32(&echoSeq, 1) & 0xffff)
+	)
+
+	start := time.Now()
+	if err = conn.SetDeadline(start.Add(timeout)); err != nil {
+		return 0, err
+	}
+	if _, err = conn.WriteTo(marshalEcho(icmpTypeEcho, id, seq, echoData), ip); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, 1500)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return 0, err
+		}
+
+		typ, replyID, replySeq, data, ok := parseEcho(buf[:n])
+		if !ok || typ != icmpTypeEchoReply || replyID != id || replySeq != seq || !bytes.Equal(data, echoData) {
+			continue
+		}
+
+		return time.Since(start), nil
+	}
+}
+
+// marshalEcho builds ICMP echo message, reference RFC 792
+func marshalEcho(typ uint8, id, seq uint16, data []byte) []byte {
+	b := make([]byte, 8+len(data))
+	b[0] = typ
+	b[1] = 0
+	binary.BigEndian.PutUint16(b[4:], id)
+	binary.BigEndian.PutUint16(b[6:], seq)
+	copy(b[8:], data)
+	binary.BigEndian.PutUint16(b[2:], checksum(b))
+
+	return b
+}
+
+func parseEcho(b []byte) (typ uint8, id, seq uint16, data []byte, ok bool) {
+	if len(b) < 8 {
+		return
+	}
+
+	return b[0], binary.BigEndian.Uint16(b[4:]), binary.BigEndian.Uint16(b[6:]), b[8:], true
+}
+
+func checksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+
+	return ^uint16(sum)
+}
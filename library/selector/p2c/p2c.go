@@ -1,2 +1,343 @@
 // p2c is reference https://exceting.github.io/2020/08/13/%E8%B4%9F%E8%BD%BD%E5%9D%87%E8%A1%A1-P2C%E7%AE%97%E6%B3%95/
 package p2c
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/why444216978/gin-api/library/selector"
+)
+
+const (
+	// defaultDecay is the time constant of EWMA
+	defaultDecay = 600 * time.Millisecond
+	// defaultForcePick is the max duration a node can be left unpicked
+	defaultForcePick = time.Second * 3
+	// initLatency is the latency of a node that has not been requested yet
+	initLatency = float64(time.Millisecond * 10)
+	// penaltyLatency is the latency sample of a failed request
+	penaltyLatency = float64(time.Second * 5)
+)
+
+type Node struct {
+	lock       sync.RWMutex
+	address    string
+	weight     int
+	meta       selector.Meta
+	statistics selector.Statistics
+	inflight   int64
+	latency    float64 // EWMA latency in nanoseconds
+	success    float64 // EWMA success rate in [0, 1]
+	stamp      int64   // last latency update time in nanoseconds
+	pick       int64   // last picked time in nanoseconds
+}
+
+var (
+	_ selector.Node        = (*Node)(nil)
+	_ selector.NewNodeFunc = NewNode
+)
+
+func NewNode(host string, port, weight int, meta selector.Meta) selector.Node {
+	return &Node{
+		address:    selector.GenerateAddress(host, port),
+		weight:     weight,
+		meta:       meta,
+		statistics: selector.Statistics{},
+		latency:    initLatency,
+		success:    1,
+	}
+}
+
+func (n *Node) Address() string {
+	return n.address
+}
+
+func (n *Node) Meta() selector.Meta {
+	return n.meta
+}
+
+func (n *Node) Statistics() selector.Statistics {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.statistics
+}
+
+func (n *Node) Weight() int {
+	return n.weight
+}
+
+// Inflight returns the count of requests which have started but not finished
+func (n *Node) Inflight() int64 {
+	return atomic.LoadInt64(&n.inflight)
+}
+
+// Latency returns the EWMA latency
+func (n *Node) Latency() time.Duration {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return time.Duration(n.latency)
+}
+
+func (n *Node) incrSuccess() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.statistics.Success = n.statistics.Success + 1
+}
+
+func (n *Node) incrFail() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.statistics.Fail = n.statistics.Fail + 1
+}
+
+// observe updates EWMA latency and success rate with one request sample
+func (n *Node) observe(cost time.Duration, err error, decay time.Duration) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	now := time.Now().UnixNano()
+	td := now - n.stamp
+	if td < 0 {
+		td = 0
+	}
+	n.stamp = now
+
+	w := math.Exp(float64(-td) / float64(decay))
+
+	latency := float64(cost)
+	success := 1.0
+	if err != nil {
+		latency = math.Max(latency, penaltyLatency)
+		success = 0
+	}
+
+	n.latency = n.latency*w + latency*(1-w)
+	n.success = n.success*w + success*(1-w)
+}
+
+// load is lower for the better node
+func (n *Node) load() float64 {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	// add 0.01 to success rate avoid division by zero
+	return math.Sqrt(n.latency+1) * float64(atomic.LoadInt64(&n.inflight)+1) / ((n.success + 0.01) * float64(n.weight))
+}
+
+type Selector struct {
+	lock        sync.RWMutex
+	nodes       map[string]*Node
+	list        []*Node
+	decay       time.Duration
+	forcePick   time.Duration
+	serviceName string
+}
+
+var (
+	_ selector.Selector = (*Selector)(nil)
+	_ selector.Starter  = (*Selector)(nil)
+)
+
+type SelectorOption func(*Selector)
+
+func WithServiceName(name string) SelectorOption {
+	return func(s *Selector) { s.serviceName = name }
+}
+
+func WithDecay(decay time.Duration) SelectorOption {
+	return func(s *Selector) { s.decay = decay }
+}
+
+func WithForcePick(forcePick time.Duration) SelectorOption {
+	return func(s *Selector) { s.forcePick = forcePick }
+}
+
+func NewSelector(opts ...SelectorOption) *Selector {
+	s := &Selector{
+		nodes: make(map[string]*Node),
+		list:  make([]*Node, 0),
+	}
+
+	for _, o := range opts {
+		o(s)
+	}
+
+	if s.decay <= 0 {
+		s.decay = defaultDecay
+	}
+
+	if s.forcePick <= 0 {
+		s.forcePick = defaultForcePick
+	}
+
+	return s
+}
+
+func (s *Selector) ServiceName() string {
+	return s.serviceName
+}
+
+func (s *Selector) AddNode(node selector.Node) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	address := node.Address()
+	if _, ok := s.nodes[address]; ok {
+		return
+	}
+
+	p2cNode := s.node2P2CNode(node)
+
+	s.nodes[address] = p2cNode
+	s.list = append(s.list, p2cNode)
+
+	return
+}
+
+func (s *Selector) DeleteNode(host string, port int) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	address := selector.GenerateAddress(host, port)
+	if _, ok := s.nodes[address]; !ok {
+		return
+	}
+
+	delete(s.nodes, address)
+
+	for idx, n := range s.list {
+		if n.Address() != address {
+			continue
+		}
+		s.list = append(s.list[:idx], s.list[idx+1:]...)
+		break
+	}
+
+	return
+}
+
+func (s *Selector) GetNodes() (nodes []selector.Node, err error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	nodes = make([]selector.Node, 0)
+	for _, n := range s.list {
+		nodes = append(nodes, n)
+	}
+	return
+}
+
+func (s *Selector) GetNode(host string, port int) (node selector.Node, ok bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	node, ok = s.nodes[selector.GenerateAddress(host, port)]
+	return
+}
+
+// Select picks two random nodes and returns the less loaded one,
+// the other one is returned if it has not been picked for forcePick.
+func (s *Selector) Select() (node selector.Node, err error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	// 权重为0的节点不再分配新请求
+	list := make([]*Node, 0, len(s.list))
+	for _, n := range s.list {
+		if n.weight > 0 {
+			list = append(list, n)
+		}
+	}
+
+	count := len(list)
+	if count == 0 {
+		err = errors.New("node is nil")
+		return
+	}
+
+	pc := list[0]
+	if count > 1 {
+		a := rand.Intn(count)
+		b := rand.Intn(count - 1)
+		if b >= a {
+			b = b + 1
+		}
+
+		var upc *Node
+		pc, upc = list[a], list[b]
+		if pc.load() > upc.load() {
+			pc, upc = upc, pc
+		}
+
+		if time.Now().UnixNano()-atomic.LoadInt64(&upc.pick) > int64(s.forcePick) {
+			pc = upc
+		}
+	}
+
+	atomic.StoreInt64(&pc.pick, time.Now().UnixNano())
+	node = pc
+
+	return
+}
+
+// BeforeHandle increases the in-flight count of address,
+// done decreases it and records the latency and result.
+func (s *Selector) BeforeHandle(address string) (done func(err error)) {
+	s.lock.RLock()
+	node := s.nodes[address]
+	s.lock.RUnlock()
+
+	if node == nil {
+		return func(err error) { s.AfterHandle(address, err) }
+	}
+
+	atomic.AddInt64(&node.inflight, 1)
+	start := time.Now()
+
+	return func(err error) {
+		atomic.AddInt64(&node.inflight, -1)
+		if selector.IsCanceled(err) {
+			return
+		}
+		node.observe(time.Since(start), err, s.decay)
+		s.AfterHandle(address, err)
+	}
+}
+
+func (s *Selector) AfterHandle(address string, err error) {
+	if selector.IsCanceled(err) {
+		return
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	node := s.nodes[address]
+	if node == nil {
+		return
+	}
+
+	if err != nil {
+		node.incrFail()
+		return
+	}
+	node.incrSuccess()
+
+	return
+}
+
+func (s *Selector) node2P2CNode(node selector.Node) *Node {
+	return &Node{
+		address:    node.Address(),
+		weight:     node.Weight(),
+		meta:       node.Meta(),
+		statistics: node.Statistics(),
+		latency:    initLatency,
+		success:    1,
+		pick:       time.Now().UnixNano(),
+	}
+}
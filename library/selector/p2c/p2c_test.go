@@ -0,0 +1,152 @@
+package p2c
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/why444216978/gin-api/library/selector"
+)
+
+func TestNewNode(t *testing.T) {
+	convey.Convey("TestNewNode", t, func() {
+		convey.Convey("success", func() {
+			ip := "127.0.0.1"
+			port := 80
+			weight := 10
+			meta := selector.Meta{}
+			node := NewNode(ip, port, weight, meta)
+			assert.Equal(t, node.Address(), selector.GenerateAddress(ip, port))
+			assert.Equal(t, node.Weight(), weight)
+			assert.Equal(t, node.Meta(), meta)
+		})
+	})
+}
+
+func TestSelector_Select(t *testing.T) {
+	convey.Convey("TestSelector_Select", t, func() {
+		convey.Convey("empty", func() {
+			s := NewSelector()
+			node, err := s.Select()
+			assert.Nil(t, node)
+			assert.NotNil(t, err)
+		})
+		convey.Convey("zero weight", func() {
+			s := NewSelector()
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 0, selector.Meta{}))
+			_ = s.AddNode(NewNode("127.0.0.2", 80, 1, selector.Meta{}))
+
+			for i := 0; i < 10; i++ {
+				node, err := s.Select()
+				assert.Nil(t, err)
+				assert.Equal(t, "127.0.0.2:80", node.Address())
+			}
+
+			_ = s.DeleteNode("127.0.0.2", 80)
+			node, err := s.Select()
+			assert.Nil(t, node)
+			assert.NotNil(t, err)
+		})
+		convey.Convey("single", func() {
+			s := NewSelector()
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 1, selector.Meta{}))
+			node, err := s.Select()
+			assert.Nil(t, err)
+			assert.Equal(t, "127.0.0.1:80", node.Address())
+		})
+		convey.Convey("avoid slow node", func() {
+			s := NewSelector(WithForcePick(time.Hour))
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 1, selector.Meta{}))
+			_ = s.AddNode(NewNode("127.0.0.2", 80, 1, selector.Meta{}))
+
+			slow, _ := s.GetNode("127.0.0.2", 80)
+			slow.(*Node).observe(time.Second, nil, s.decay)
+
+			for i := 0; i < 100; i++ {
+				node, err := s.Select()
+				assert.Nil(t, err)
+				assert.Equal(t, "127.0.0.1:80", node.Address())
+			}
+		})
+		convey.Convey("avoid busy node", func() {
+			s := NewSelector(WithForcePick(time.Hour))
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 1, selector.Meta{}))
+			_ = s.AddNode(NewNode("127.0.0.2", 80, 1, selector.Meta{}))
+
+			for i := 0; i < 10; i++ {
+				_ = s.BeforeHandle("127.0.0.2:80")
+			}
+
+			for i := 0; i < 100; i++ {
+				node, err := s.Select()
+				assert.Nil(t, err)
+				assert.Equal(t, "127.0.0.1:80", node.Address())
+			}
+		})
+		convey.Convey("force pick", func() {
+			s := NewSelector(WithForcePick(time.Nanosecond))
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 1, selector.Meta{}))
+			_ = s.AddNode(NewNode("127.0.0.2", 80, 1, selector.Meta{}))
+
+			slow, _ := s.GetNode("127.0.0.2", 80)
+			slow.(*Node).observe(time.Second, nil, s.decay)
+
+			res := map[string]int{}
+			for i := 0; i < 100; i++ {
+				node, _ := s.Select()
+				res[node.Address()]++
+				time.Sleep(time.Microsecond)
+			}
+			assert.Greater(t, res["127.0.0.2:80"], 0)
+		})
+	})
+}
+
+func TestSelector_BeforeHandle(t *testing.T) {
+	convey.Convey("TestSelector_BeforeHandle", t, func() {
+		convey.Convey("success", func() {
+			s := NewSelector()
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 1, selector.Meta{}))
+			n, _ := s.GetNode("127.0.0.1", 80)
+			node := n.(*Node)
+
+			done := s.BeforeHandle("127.0.0.1:80")
+			assert.Equal(t, int64(1), node.Inflight())
+
+			done(nil)
+			assert.Equal(t, int64(0), node.Inflight())
+			assert.Equal(t, selector.Statistics{Success: 1}, node.Statistics())
+
+			latency := node.Latency()
+			s.BeforeHandle("127.0.0.1:80")(assert.AnError)
+			assert.Equal(t, selector.Statistics{Success: 1, Fail: 1}, node.Statistics())
+			assert.Greater(t, node.Latency(), latency)
+		})
+		convey.Convey("unknown node", func() {
+			s := NewSelector()
+			done := s.BeforeHandle("127.0.0.1:80")
+			done(nil)
+		})
+	})
+}
+
+func TestSelector_DeleteNode(t *testing.T) {
+	convey.Convey("TestSelector_DeleteNode", t, func() {
+		convey.Convey("success", func() {
+			s := NewSelector()
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 1, selector.Meta{}))
+			_ = s.AddNode(NewNode("127.0.0.2", 80, 1, selector.Meta{}))
+
+			_ = s.DeleteNode("127.0.0.2", 80)
+			nodes, _ := s.GetNodes()
+			assert.Len(t, nodes, 1)
+
+			for i := 0; i < 10; i++ {
+				node, _ := s.Select()
+				assert.Equal(t, "127.0.0.1:80", node.Address())
+			}
+		})
+	})
+}
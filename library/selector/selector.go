@@ -1,25 +1,45 @@
 package selector
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 )
 
 const (
-	TypeWR   = "wr"
-	TypeWrr  = "wrr"
-	TypeDwrr = "dwrr"
-	TypeP2C  = "p2c"
-	TypeICMP = "icmp"
+	TypeWR    = "wr"
+	TypeWrr   = "wrr"
+	TypeDwrr  = "dwrr"
+	TypeP2C   = "p2c"
+	TypeICMP  = "icmp"
+	TypeCHash = "chash"
 )
 
+// ErrCanceled is reported when the request is abandoned without a reply counting for the node,
+// such as aborted locally by middleware or canceled as the loser of hedging, the in-flight state is released without counting success or failure.
+var ErrCanceled = errors.New("request canceled")
+
+// IsCanceled checks whether err is ErrCanceled
+func IsCanceled(err error) bool {
+	return errors.Is(err, ErrCanceled)
+}
+
 type Statistics struct {
 	Success uint64
 	Fail    uint64
 }
 
-type Meta struct{}
+// Meta is the labels of node published by registry
+type Meta map[string]string
+
+// well-known keys of Meta
+const (
+	MetaZone     = "zone"
+	MetaVersion  = "version"
+	MetaCanary   = "canary"
+	MetaProtocol = "protocol"
+)
 
 type Node interface {
 	Address() string
@@ -45,6 +65,18 @@ type Selector interface {
 	AfterHandle(address string, err error)
 }
 
+// KeySelector is implemented by selectors which keep the same key on the same node, such as chash.
+type KeySelector interface {
+	SelectByKey(key string) (node Node, err error)
+}
+
+// Starter is implemented by selectors which need to know when a request starts,
+// such as p2c tracking in-flight requests and latency.
+// The returned done func is called when the request finishes, in place of AfterHandle.
+type Starter interface {
+	BeforeHandle(address string) (done func(err error))
+}
+
 func GenerateAddress(host string, port int) string {
 	return fmt.Sprintf("%s:%d", host, port)
 }
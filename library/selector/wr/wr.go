@@ -115,30 +115,13 @@ func (s *Selector) AddNode(node selector.Node) (err error) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
-	var (
-		weight      = node.Weight()
-		offsetStart = 0
-		offsetEnd   = s.totalWeight + weight
-	)
-	if s.nodeCount > 0 {
-		offsetStart = s.totalWeight + 1
-	}
-
-	offset := nodeOffset{
-		Address:     address,
-		Weight:      weight,
-		OffsetStart: offsetStart,
-		OffsetEnd:   offsetEnd,
-	}
-
 	wrNode := s.node2WRNode(node)
 
-	s.totalWeight = offsetEnd
 	s.nodes[node.Address()] = wrNode
 	s.list = append(s.list, wrNode)
-	s.offsetList = append(s.offsetList, offset)
 	s.nodeCount = s.nodeCount + 1
 
+	s.resetOffset()
 	s.sortOffset()
 	s.checkSameWeight()
 
@@ -147,7 +130,7 @@ func (s *Selector) AddNode(node selector.Node) (err error) {
 
 func (s *Selector) DeleteNode(host string, port int) (err error) {
 	address := selector.GenerateAddress(host, port)
-	node, ok := s.nodes[address]
+	_, ok := s.nodes[address]
 	if !ok {
 		return
 	}
@@ -168,16 +151,7 @@ func (s *Selector) DeleteNode(host string, port int) (err error) {
 		s.list = new
 	}
 
-	for idx, n := range s.offsetList {
-		if n.Address != address {
-			continue
-		}
-		s.totalWeight = s.totalWeight - node.Weight()
-		new := make([]nodeOffset, len(s.offsetList)-1)
-		new = append(s.offsetList[:idx], s.offsetList[idx+1:]...)
-		s.offsetList = new
-	}
-
+	s.resetOffset()
 	s.sortOffset()
 	s.checkSameWeight()
 
@@ -214,6 +188,11 @@ func (s *Selector) Select() (node selector.Node, err error) {
 		err = errors.New("node is nil")
 	}()
 
+	// 权重为0的节点不在offsetList中，不再分配新请求
+	if len(s.offsetList) == 0 {
+		return
+	}
+
 	if s.sameWeight {
 		idx := rand.Intn(s.nodeCount)
 		node = s.list[idx]
@@ -232,6 +211,10 @@ func (s *Selector) Select() (node selector.Node, err error) {
 }
 
 func (s *Selector) AfterHandle(address string, err error) {
+	if selector.IsCanceled(err) {
+		return
+	}
+
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 
@@ -252,15 +235,8 @@ func (s *Selector) AfterHandle(address string, err error) {
 func (s *Selector) checkSameWeight() {
 	s.sameWeight = true
 
-	var last int
 	for _, n := range s.list {
-		cur := int(n.weight)
-		if last == 0 {
-			last = cur
-			continue
-		}
-		if last == cur {
-			last = cur
+		if n.weight == s.list[0].weight {
 			continue
 		}
 		s.sameWeight = false
@@ -268,6 +244,32 @@ func (s *Selector) checkSameWeight() {
 	}
 }
 
+// resetOffset rebuilds offsetList by list, the offsets after the deleted node must move forward,
+// the node with zero weight is skipped
+func (s *Selector) resetOffset() {
+	s.totalWeight = 0
+	s.offsetList = make([]nodeOffset, 0, len(s.list))
+
+	for _, n := range s.list {
+		if n.weight <= 0 {
+			continue
+		}
+		offsetStart := 0
+		if len(s.offsetList) > 0 {
+			offsetStart = s.totalWeight + 1
+		}
+		offsetEnd := s.totalWeight + n.weight
+
+		s.offsetList = append(s.offsetList, nodeOffset{
+			Address:     n.address,
+			Weight:      n.weight,
+			OffsetStart: offsetStart,
+			OffsetEnd:   offsetEnd,
+		})
+		s.totalWeight = offsetEnd
+	}
+}
+
 func (s *Selector) sortOffset() {
 	sort.Slice(s.offsetList, func(i, j int) bool {
 		return s.offsetList[i].Weight > s.offsetList[j].Weight
@@ -65,12 +65,53 @@ func TestSelector_AddNode(t *testing.T) {
 }
 
 func TestSelector_DeleteNode(t *testing.T) {
+	convey.Convey("TestSelector_DeleteNode", t, func() {
+		convey.Convey("reset offset", func() {
+			s := NewSelector()
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 3, selector.Meta{}))
+			_ = s.AddNode(NewNode("127.0.0.2", 80, 2, selector.Meta{}))
+			_ = s.AddNode(NewNode("127.0.0.3", 80, 1, selector.Meta{}))
+
+			_ = s.DeleteNode("127.0.0.1", 80)
+			assert.Equal(t, 3, s.totalWeight)
+
+			for i := 0; i < 100; i++ {
+				node, err := s.Select()
+				assert.Nil(t, err)
+				assert.NotEqual(t, "127.0.0.1:80", node.Address())
+			}
+		})
+	})
 }
 
 func TestSelector_GetNodes(t *testing.T) {
 }
 
 func TestSelector_Select(t *testing.T) {
+	convey.Convey("TestSelector_Select", t, func() {
+		convey.Convey("empty", func() {
+			s := NewSelector()
+			node, err := s.Select()
+			assert.Nil(t, node)
+			assert.NotNil(t, err)
+		})
+		convey.Convey("zero weight", func() {
+			s := NewSelector()
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 0, selector.Meta{}))
+			_ = s.AddNode(NewNode("127.0.0.2", 80, 1, selector.Meta{}))
+
+			for i := 0; i < 10; i++ {
+				node, err := s.Select()
+				assert.Nil(t, err)
+				assert.Equal(t, "127.0.0.2:80", node.Address())
+			}
+
+			_ = s.DeleteNode("127.0.0.2", 80)
+			node, err := s.Select()
+			assert.Nil(t, node)
+			assert.NotNil(t, err)
+		})
+	})
 }
 
 func TestSelector_AfterHandle(t *testing.T) {
@@ -91,12 +132,15 @@ func TestWR(t *testing.T) {
 			nodes := []*Node{
 				{
 					address: "127.0.0.1:80",
+					weight:  1,
 				},
 				{
 					address: "127.0.0.2:80",
+					weight:  1,
 				},
 				{
 					address: "127.0.0.3:80",
+					weight:  1,
 				},
 			}
 			res := testNoDeleteHandle(t, nodes)
@@ -130,12 +174,15 @@ func TestWR(t *testing.T) {
 			nodes := []*Node{
 				{
 					address: "127.0.0.1:80",
+					weight:  1,
 				},
 				{
 					address: "127.0.0.2:80",
+					weight:  1,
 				},
 				{
 					address: "127.0.0.3:80",
+					weight:  1,
 				},
 			}
 			res := testDeleteHandle(t, nodes)
@@ -1,3 +1,230 @@
 // wrr is Weighted Round Robin
 // reference Nginx https://blog.csdn.net/zhangskd/article/details/50194069
 package wrr
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/why444216978/gin-api/library/selector"
+)
+
+type Node struct {
+	lock          sync.RWMutex
+	address       string
+	weight        int
+	currentWeight int
+	meta          selector.Meta
+	statistics    selector.Statistics
+}
+
+var (
+	_ selector.Node        = (*Node)(nil)
+	_ selector.NewNodeFunc = NewNode
+)
+
+func NewNode(host string, port, weight int, meta selector.Meta) selector.Node {
+	return &Node{
+		address:    selector.GenerateAddress(host, port),
+		weight:     weight,
+		meta:       meta,
+		statistics: selector.Statistics{},
+	}
+}
+
+func (n *Node) Address() string {
+	return n.address
+}
+
+func (n *Node) Meta() selector.Meta {
+	return n.meta
+}
+
+func (n *Node) Statistics() selector.Statistics {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.statistics
+}
+
+func (n *Node) Weight() int {
+	return n.weight
+}
+
+func (n *Node) incrSuccess() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.statistics.Success = n.statistics.Success + 1
+}
+
+func (n *Node) incrFail() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.statistics.Fail = n.statistics.Fail + 1
+}
+
+type Selector struct {
+	lock        sync.Mutex
+	nodes       map[string]*Node
+	list        []*Node
+	serviceName string
+}
+
+var _ selector.Selector = (*Selector)(nil)
+
+type SelectorOption func(*Selector)
+
+func WithServiceName(name string) SelectorOption {
+	return func(s *Selector) { s.serviceName = name }
+}
+
+func NewSelector(opts ...SelectorOption) *Selector {
+	s := &Selector{
+		nodes: make(map[string]*Node),
+		list:  make([]*Node, 0),
+	}
+
+	for _, o := range opts {
+		o(s)
+	}
+
+	return s
+}
+
+func (s *Selector) ServiceName() string {
+	return s.serviceName
+}
+
+func (s *Selector) AddNode(node selector.Node) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	address := node.Address()
+	if _, ok := s.nodes[address]; ok {
+		return
+	}
+
+	wrrNode := s.node2WRRNode(node)
+
+	s.nodes[address] = wrrNode
+	s.list = append(s.list, wrrNode)
+
+	return
+}
+
+func (s *Selector) DeleteNode(host string, port int) (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	address := selector.GenerateAddress(host, port)
+	if _, ok := s.nodes[address]; !ok {
+		return
+	}
+
+	delete(s.nodes, address)
+
+	for idx, n := range s.list {
+		if n.Address() != address {
+			continue
+		}
+		s.list = append(s.list[:idx], s.list[idx+1:]...)
+		break
+	}
+
+	// reset current weight, avoid the remaining nodes inherit the deleted node's offset
+	for _, n := range s.list {
+		n.currentWeight = 0
+	}
+
+	return
+}
+
+func (s *Selector) GetNodes() (nodes []selector.Node, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	nodes = make([]selector.Node, 0)
+	for _, n := range s.list {
+		nodes = append(nodes, n)
+	}
+	return
+}
+
+func (s *Selector) GetNode(host string, port int) (node selector.Node, ok bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	node, ok = s.nodes[selector.GenerateAddress(host, port)]
+	return
+}
+
+// Select is smooth weighted round robin:
+// every round each node's currentWeight increases by its weight,
+// the node with the max currentWeight is selected and decreased by totalWeight.
+func (s *Selector) Select() (node selector.Node, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var (
+		best        *Node
+		totalWeight int
+	)
+
+	for _, n := range s.list {
+		// 权重为0的节点不再分配新请求
+		if n.weight <= 0 {
+			continue
+		}
+		n.currentWeight = n.currentWeight + n.weight
+		totalWeight = totalWeight + n.weight
+
+		if best == nil || n.currentWeight > best.currentWeight {
+			best = n
+		}
+	}
+
+	if best == nil {
+		err = errors.New("node is nil")
+		return
+	}
+
+	best.currentWeight = best.currentWeight - totalWeight
+	node = best
+
+	return
+}
+
+func (s *Selector) AfterHandle(address string, err error) {
+	if selector.IsCanceled(err) {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	node := s.nodes[address]
+	if node == nil {
+		return
+	}
+
+	if err != nil {
+		node.incrFail()
+		return
+	}
+	node.incrSuccess()
+
+	return
+}
+
+func (s *Selector) node2WRRNode(node selector.Node) *Node {
+	weight := node.Weight()
+	if weight < 0 {
+		weight = 0
+	}
+
+	return &Node{
+		address:    node.Address(),
+		weight:     weight,
+		meta:       node.Meta(),
+		statistics: node.Statistics(),
+	}
+}
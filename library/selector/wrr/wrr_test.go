@@ -0,0 +1,120 @@
+package wrr
+
+import (
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/why444216978/gin-api/library/selector"
+)
+
+func TestNewNode(t *testing.T) {
+	convey.Convey("TestNewNode", t, func() {
+		convey.Convey("success", func() {
+			ip := "127.0.0.1"
+			port := 80
+			weight := 10
+			meta := selector.Meta{}
+			node := NewNode(ip, port, weight, meta)
+			assert.Equal(t, node.Address(), selector.GenerateAddress(ip, port))
+			assert.Equal(t, node.Weight(), weight)
+			assert.Equal(t, node.Meta(), meta)
+		})
+	})
+}
+
+func TestSelector_ServiceName(t *testing.T) {
+	convey.Convey("TestSelector_ServiceName", t, func() {
+		convey.Convey("success", func() {
+			s := NewSelector(WithServiceName("test_service"))
+			assert.Equal(t, s.ServiceName(), "test_service")
+		})
+	})
+}
+
+func TestSelector_Select(t *testing.T) {
+	convey.Convey("TestSelector_Select", t, func() {
+		convey.Convey("empty", func() {
+			s := NewSelector()
+			node, err := s.Select()
+			assert.Nil(t, node)
+			assert.NotNil(t, err)
+		})
+		convey.Convey("smooth", func() {
+			s := NewSelector()
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 5, selector.Meta{}))
+			_ = s.AddNode(NewNode("127.0.0.2", 80, 1, selector.Meta{}))
+			_ = s.AddNode(NewNode("127.0.0.3", 80, 1, selector.Meta{}))
+
+			// nginx sequence for weight {5, 1, 1} is a a b a c a a
+			expect := []string{
+				"127.0.0.1:80", "127.0.0.1:80", "127.0.0.2:80", "127.0.0.1:80",
+				"127.0.0.3:80", "127.0.0.1:80", "127.0.0.1:80",
+			}
+			for i := 0; i < 3; i++ {
+				for _, address := range expect {
+					node, err := s.Select()
+					assert.Nil(t, err)
+					assert.Equal(t, address, node.Address())
+				}
+			}
+		})
+		convey.Convey("zero weight", func() {
+			s := NewSelector()
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 0, selector.Meta{}))
+			_ = s.AddNode(NewNode("127.0.0.2", 80, 1, selector.Meta{}))
+
+			for i := 0; i < 10; i++ {
+				node, err := s.Select()
+				assert.Nil(t, err)
+				assert.Equal(t, "127.0.0.2:80", node.Address())
+			}
+
+			_ = s.DeleteNode("127.0.0.2", 80)
+			_, err := s.Select()
+			assert.NotNil(t, err)
+		})
+	})
+}
+
+func TestSelector_DeleteNode(t *testing.T) {
+	convey.Convey("TestSelector_DeleteNode", t, func() {
+		convey.Convey("success", func() {
+			s := NewSelector()
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 2, selector.Meta{}))
+			_ = s.AddNode(NewNode("127.0.0.2", 80, 2, selector.Meta{}))
+			_ = s.AddNode(NewNode("127.0.0.3", 80, 1, selector.Meta{}))
+
+			_ = s.DeleteNode("127.0.0.3", 80)
+			_, ok := s.GetNode("127.0.0.3", 80)
+			assert.Equal(t, false, ok)
+
+			nodes, _ := s.GetNodes()
+			assert.Len(t, nodes, 2)
+
+			for i := 0; i < 100; i++ {
+				node, err := s.Select()
+				assert.Nil(t, err)
+				assert.NotEqual(t, "127.0.0.3:80", node.Address())
+			}
+		})
+	})
+}
+
+func TestSelector_AfterHandle(t *testing.T) {
+	convey.Convey("TestSelector_AfterHandle", t, func() {
+		convey.Convey("success", func() {
+			s := NewSelector()
+			_ = s.AddNode(NewNode("127.0.0.1", 80, 1, selector.Meta{}))
+
+			s.AfterHandle("127.0.0.1:80", nil)
+			s.AfterHandle("127.0.0.1:80", nil)
+			s.AfterHandle("127.0.0.1:80", assert.AnError)
+			s.AfterHandle("127.0.0.2:80", nil)
+
+			node, _ := s.GetNode("127.0.0.1", 80)
+			assert.Equal(t, selector.Statistics{Success: 2, Fail: 1}, node.Statistics())
+		})
+	})
+}
@@ -0,0 +1,303 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/why444216978/go-util/assert"
+
+	"github.com/why444216978/gin-api/library/logger"
+	"github.com/why444216978/gin-api/library/registry"
+	"github.com/why444216978/gin-api/library/selector"
+	"github.com/why444216978/gin-api/library/servicer"
+)
+
+const (
+	defaultOutlierIntervalSecond     = 10
+	defaultOutlierBaseEjectionSecond = 30
+	defaultOutlierMaxEjectionSecond  = 300
+	defaultOutlierMaxEjectionPercent = 10
+)
+
+// OutlierConfig is the config of Envoy-style outlier detection,
+// it is disabled when both ConsecutiveErrors and ErrorRate are zero.
+type OutlierConfig struct {
+	// ConsecutiveErrors ejects the node when its consecutive errors reach it
+	ConsecutiveErrors int `validate:"min=0"`
+	// ErrorRate ejects the node when its error rate in IntervalSecond reaches it
+	ErrorRate float64 `validate:"min=0,max=1"`
+	// MinRequest is the min requests in IntervalSecond to calculate ErrorRate
+	MinRequest int `validate:"min=0"`
+	// IntervalSecond is the window of ErrorRate
+	IntervalSecond int `validate:"min=0"`
+	// BaseEjectionSecond is the first ejection duration, it doubles on every ejection
+	BaseEjectionSecond int `validate:"min=0"`
+	// MaxEjectionSecond is the max ejection duration
+	MaxEjectionSecond int `validate:"min=0"`
+	// MaxEjectionPercent is the max percent of ejected nodes, at least one node can be ejected
+	MaxEjectionPercent int `validate:"min=0,max=100"`
+}
+
+func (c OutlierConfig) enabled() bool {
+	return c.ConsecutiveErrors > 0 || c.ErrorRate > 0
+}
+
+type outlierNode struct {
+	consecutive  int
+	success      int
+	fail         int
+	windowStart  time.Time
+	ejectedUntil time.Time
+	times        int
+	ejected      bool
+}
+
+type outlierDetector struct {
+	lock              sync.Mutex
+	nodes             map[string]*outlierNode
+	consecutiveErrors int
+	errorRate         float64
+	minRequest        int
+	interval          time.Duration
+	baseEjection      time.Duration
+	maxEjection       time.Duration
+	maxEjectPercent   int
+}
+
+func newOutlierDetector(cfg OutlierConfig) *outlierDetector {
+	d := &outlierDetector{
+		nodes:             make(map[string]*outlierNode),
+		consecutiveErrors: cfg.ConsecutiveErrors,
+		errorRate:         cfg.ErrorRate,
+		minRequest:        cfg.MinRequest,
+		interval:          time.Duration(cfg.IntervalSecond) * time.Second,
+		baseEjection:      time.Duration(cfg.BaseEjectionSecond) * time.Second,
+		maxEjection:       time.Duration(cfg.MaxEjectionSecond) * time.Second,
+		maxEjectPercent:   cfg.MaxEjectionPercent,
+	}
+
+	if d.interval <= 0 {
+		d.interval = defaultOutlierIntervalSecond * time.Second
+	}
+	if d.baseEjection <= 0 {
+		d.baseEjection = defaultOutlierBaseEjectionSecond * time.Second
+	}
+	if d.maxEjection <= 0 {
+		d.maxEjection = defaultOutlierMaxEjectionSecond * time.Second
+	}
+	if d.maxEjection < d.baseEjection {
+		d.maxEjection = d.baseEjection
+	}
+	if d.maxEjectPercent <= 0 {
+		d.maxEjectPercent = defaultOutlierMaxEjectionPercent
+	}
+
+	return d
+}
+
+// record counts the result of a request to address, total is the count of all nodes,
+// it returns the ejection duration when the node should be ejected.
+func (d *outlierDetector) record(address string, err error, total int) (eject bool, duration time.Duration) {
+	// 未得到节点响应的请求不计入
+	if selector.IsCanceled(err) {
+		return
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	now := time.Now()
+
+	n, ok := d.nodes[address]
+	if !ok {
+		n = &outlierNode{windowStart: now}
+		d.nodes[address] = n
+	}
+
+	// requests finishing after the node ejected are ignored
+	if n.ejected {
+		return
+	}
+
+	if now.Sub(n.windowStart) >= d.interval {
+		n.success, n.fail, n.windowStart = 0, 0, now
+		// the node keeps healthy for a long time, restart the ejection backoff
+		if n.times > 0 && now.Sub(n.ejectedUntil) >= d.maxEjection {
+			n.times = 0
+		}
+	}
+
+	if err == nil {
+		n.consecutive = 0
+		n.success = n.success + 1
+		return
+	}
+	n.consecutive = n.consecutive + 1
+	n.fail = n.fail + 1
+
+	if !d.isOutlier(n) || !d.canEject(total) {
+		return
+	}
+
+	n.times = n.times + 1
+	duration = d.baseEjection << uint(n.times-1)
+	if duration <= 0 || duration > d.maxEjection {
+		duration = d.maxEjection
+	}
+	n.ejectedUntil = now.Add(duration)
+	n.ejected = true
+	n.consecutive, n.success, n.fail, n.windowStart = 0, 0, 0, now
+
+	return true, duration
+}
+
+func (d *outlierDetector) isOutlier(n *outlierNode) bool {
+	if d.consecutiveErrors > 0 && n.consecutive >= d.consecutiveErrors {
+		return true
+	}
+
+	requests := n.success + n.fail
+	if d.errorRate > 0 && requests > 0 && requests >= d.minRequest &&
+		float64(n.fail)/float64(requests) >= d.errorRate {
+		return true
+	}
+
+	return false
+}
+
+// canEject checks max ejection percent, at least one node can be ejected but never all nodes
+func (d *outlierDetector) canEject(total int) bool {
+	if total <= 1 {
+		return false
+	}
+
+	max := total * d.maxEjectPercent / 100
+	if max < 1 {
+		max = 1
+	}
+
+	return d.ejectedCount() < max
+}
+
+func (d *outlierDetector) ejectedCount() (count int) {
+	for _, n := range d.nodes {
+		if n.ejected {
+			count++
+		}
+	}
+	return
+}
+
+// recover returns the addresses whose ejection expired
+func (d *outlierDetector) recover() (addresses []string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	now := time.Now()
+	for address, n := range d.nodes {
+		if !n.ejected || now.Before(n.ejectedUntil) {
+			continue
+		}
+		n.ejected = false
+		n.consecutive, n.success, n.fail, n.windowStart = 0, 0, 0, now
+		addresses = append(addresses, address)
+	}
+
+	return
+}
+
+func (d *outlierDetector) isEjected(address string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	n, ok := d.nodes[address]
+	if !ok {
+		return false
+	}
+	return n.ejected
+}
+
+// clean deletes the states of nodes which not exist
+func (d *outlierDetector) clean(exists map[string]struct{}) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	for address := range d.nodes {
+		if _, ok := exists[address]; !ok {
+			delete(d.nodes, address)
+		}
+	}
+}
+
+// detectOutlier records the request result, and ejects the node when it is an outlier
+func (s *Service) detectOutlier(ctx context.Context, node *servicer.Node, err error) {
+	if s.outlier == nil {
+		return
+	}
+
+	total := len(s.discovery.GetNodes())
+	eject, duration := s.outlier.record(selector.GenerateAddress(node.Host, node.Port), err, total)
+	if !eject {
+		return
+	}
+	atomic.StoreInt32(&s.resync, 1)
+
+	if assert.IsNil(s.logger) {
+		return
+	}
+	s.logger.Warn(ctx, "outlier node ejected",
+		logger.Reflect(logger.ServiceName, s.Name()),
+		logger.Reflect(logger.ServerIP, node.Host),
+		logger.Reflect(logger.ServerPort, node.Port),
+		logger.Reflect("ejection_duration", duration.String()),
+		logger.Error(err))
+}
+
+// recoverOutlier puts the nodes whose ejection expired back
+func (s *Service) recoverOutlier(ctx context.Context) {
+	if s.outlier == nil {
+		return
+	}
+
+	addresses := s.outlier.recover()
+	if len(addresses) == 0 {
+		return
+	}
+	atomic.StoreInt32(&s.resync, 1)
+
+	if assert.IsNil(s.logger) {
+		return
+	}
+	for _, address := range addresses {
+		host, port := selector.ExtractAddress(address)
+		s.logger.Info(ctx, "outlier node recovered",
+			logger.Reflect(logger.ServiceName, s.Name()),
+			logger.Reflect(logger.ServerIP, host),
+			logger.Reflect(logger.ServerPort, port))
+	}
+}
+
+// filterEjected removes the ejected nodes, and cleans the states of nodes which not exist
+func (s *Service) filterEjected(nodes []*registry.Node) []*registry.Node {
+	if s.outlier == nil {
+		return nodes
+	}
+
+	var (
+		res    = make([]*registry.Node, 0, len(nodes))
+		exists = make(map[string]struct{}, len(nodes))
+	)
+	for _, n := range nodes {
+		address := selector.GenerateAddress(n.Host, n.Port)
+		exists[address] = struct{}{}
+		if s.outlier.isEjected(address) {
+			continue
+		}
+		res = append(res, n)
+	}
+	s.outlier.clean(exists)
+
+	return res
+}
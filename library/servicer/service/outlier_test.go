@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/why444216978/gin-api/library/registry"
+	"github.com/why444216978/gin-api/library/selector"
+	"github.com/why444216978/gin-api/library/servicer"
+)
+
+func TestOutlierDetector_record(t *testing.T) {
+	convey.Convey("TestOutlierDetector_record", t, func() {
+		convey.Convey("consecutive errors", func() {
+			d := newOutlierDetector(OutlierConfig{ConsecutiveErrors: 3, MaxEjectionPercent: 50})
+
+			eject, _ := d.record("127.0.0.1:80", assert.AnError, 2)
+			assert.Equal(t, false, eject)
+			eject, _ = d.record("127.0.0.1:80", assert.AnError, 2)
+			assert.Equal(t, false, eject)
+			eject, _ = d.record("127.0.0.1:80", nil, 2)
+			assert.Equal(t, false, eject)
+
+			for i := 0; i < 2; i++ {
+				eject, _ = d.record("127.0.0.1:80", assert.AnError, 2)
+				assert.Equal(t, false, eject)
+			}
+			eject, duration := d.record("127.0.0.1:80", assert.AnError, 2)
+			assert.Equal(t, true, eject)
+			assert.Equal(t, defaultOutlierBaseEjectionSecond*time.Second, duration)
+			assert.Equal(t, true, d.isEjected("127.0.0.1:80"))
+		})
+		convey.Convey("canceled ignored", func() {
+			d := newOutlierDetector(OutlierConfig{ConsecutiveErrors: 2, MaxEjectionPercent: 50})
+
+			eject, _ := d.record("127.0.0.1:80", assert.AnError, 2)
+			assert.Equal(t, false, eject)
+			eject, _ = d.record("127.0.0.1:80", selector.ErrCanceled, 2)
+			assert.Equal(t, false, eject)
+			eject, _ = d.record("127.0.0.1:80", assert.AnError, 2)
+			assert.Equal(t, true, eject)
+		})
+		convey.Convey("error rate", func() {
+			d := newOutlierDetector(OutlierConfig{ErrorRate: 0.5, MinRequest: 4, MaxEjectionPercent: 50})
+
+			eject, _ := d.record("127.0.0.1:80", assert.AnError, 2)
+			assert.Equal(t, false, eject)
+			eject, _ = d.record("127.0.0.1:80", nil, 2)
+			assert.Equal(t, false, eject)
+			eject, _ = d.record("127.0.0.1:80", nil, 2)
+			assert.Equal(t, false, eject)
+			eject, _ = d.record("127.0.0.1:80", assert.AnError, 2)
+			assert.Equal(t, true, eject)
+		})
+		convey.Convey("max ejection percent", func() {
+			d := newOutlierDetector(OutlierConfig{ConsecutiveErrors: 1, MaxEjectionPercent: 10})
+
+			eject, _ := d.record("127.0.0.1:80", assert.AnError, 3)
+			assert.Equal(t, true, eject)
+			eject, _ = d.record("127.0.0.2:80", assert.AnError, 3)
+			assert.Equal(t, false, eject)
+
+			// never eject the only node
+			d = newOutlierDetector(OutlierConfig{ConsecutiveErrors: 1, MaxEjectionPercent: 100})
+			eject, _ = d.record("127.0.0.1:80", assert.AnError, 1)
+			assert.Equal(t, false, eject)
+		})
+		convey.Convey("exponential ejection duration", func() {
+			d := newOutlierDetector(OutlierConfig{ConsecutiveErrors: 1, BaseEjectionSecond: 1, MaxEjectionSecond: 3, MaxEjectionPercent: 50})
+			expect := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}
+			for _, e := range expect {
+				eject, duration := d.record("127.0.0.1:80", assert.AnError, 2)
+				assert.Equal(t, true, eject)
+				assert.Equal(t, e, duration)
+
+				d.nodes["127.0.0.1:80"].ejectedUntil = time.Now()
+				assert.Equal(t, []string{"127.0.0.1:80"}, d.recover())
+				assert.Equal(t, false, d.isEjected("127.0.0.1:80"))
+			}
+		})
+	})
+}
+
+func TestService_Outlier(t *testing.T) {
+	convey.Convey("TestService_Outlier", t, func() {
+		convey.Convey("eject and recover", func() {
+			d := &mockDiscovery{}
+			d.setNodes([]*registry.Node{
+				{Host: "127.0.0.1", Port: 80, Weight: 1},
+				{Host: "127.0.0.2", Port: 80, Weight: 1},
+			})
+			s, err := NewService(&Config{
+				ServiceName: "test_service",
+				Type:        servicer.TypeRegistry,
+				Host:        "127.0.0.1",
+				Port:        80,
+				Selector:    selector.TypeWrr,
+				Outlier: OutlierConfig{
+					ConsecutiveErrors:  2,
+					MaxEjectionPercent: 50,
+				},
+			}, WithDiscovery(d))
+			assert.Nil(t, err)
+
+			ctx := context.Background()
+			bad := &servicer.Node{Host: "127.0.0.2", Port: 80}
+			_ = s.Done(ctx, bad, assert.AnError)
+			_ = s.Done(ctx, bad, assert.AnError)
+
+			for i := 0; i < 10; i++ {
+				node, err := s.Pick(ctx)
+				assert.Nil(t, err)
+				assert.Equal(t, "127.0.0.1", node.Host)
+			}
+
+			s.outlier.nodes["127.0.0.2:80"].ejectedUntil = time.Now()
+			res := map[string]int{}
+			for i := 0; i < 10; i++ {
+				node, err := s.Pick(ctx)
+				assert.Nil(t, err)
+				res[node.Host]++
+			}
+			assert.Equal(t, 5, res["127.0.0.2"])
+		})
+	})
+}
@@ -2,9 +2,11 @@ package service
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"net"
 	"path/filepath"
+	"reflect"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -13,16 +15,25 @@ import (
 	utilDir "github.com/why444216978/go-util/dir"
 	"github.com/why444216978/go-util/validate"
 
+	"github.com/why444216978/gin-api/library/breaker"
 	"github.com/why444216978/gin-api/library/config"
 	"github.com/why444216978/gin-api/library/etcd"
+	"github.com/why444216978/gin-api/library/logger"
 	"github.com/why444216978/gin-api/library/registry"
 	registryEtcd "github.com/why444216978/gin-api/library/registry/etcd"
+	"github.com/why444216978/gin-api/library/retry"
 	"github.com/why444216978/gin-api/library/selector"
+	"github.com/why444216978/gin-api/library/selector/chash"
+	"github.com/why444216978/gin-api/library/selector/dwrr"
+	"github.com/why444216978/gin-api/library/selector/icmp"
+	"github.com/why444216978/gin-api/library/selector/p2c"
 	"github.com/why444216978/gin-api/library/selector/wr"
+	"github.com/why444216978/gin-api/library/selector/wrr"
 	"github.com/why444216978/gin-api/library/servicer"
+	"github.com/why444216978/gin-api/library/signature"
 )
 
-func LoadGlobPattern(path, suffix string, etcd *etcd.Etcd) (err error) {
+func LoadGlobPattern(path, suffix string, etcd *etcd.Etcd, opts ...Option) (err error) {
 	var (
 		dir   string
 		files []string
@@ -36,10 +47,12 @@ func LoadGlobPattern(path, suffix string, etcd *etcd.Etcd) (err error) {
 		return
 	}
 
-	var discover registry.Discovery
 	info := utilDir.FileInfo{}
-	cfg := &Config{}
 	for _, f := range files {
+		var (
+			discover registry.Discovery
+			cfg      = &Config{}
+		)
 		if info, err = utilDir.GetPathInfo(f); err != nil {
 			return
 		}
@@ -51,17 +64,17 @@ func LoadGlobPattern(path, suffix string, etcd *etcd.Etcd) (err error) {
 			if assert.IsNil(etcd) {
 				return errors.New("LoadGlobPattern etcd nil")
 			}
-			opts := []registryEtcd.DiscoverOption{
+			discoverOpts := []registryEtcd.DiscoverOption{
 				registryEtcd.WithServierName(cfg.ServiceName),
 				registryEtcd.WithRefreshDuration(cfg.RefreshSecond),
 				registryEtcd.WithDiscoverClient(etcd.Client),
 			}
-			if discover, err = registryEtcd.NewDiscovery(opts...); err != nil {
+			if discover, err = registryEtcd.NewDiscovery(discoverOpts...); err != nil {
 				return
 			}
 		}
 
-		if err = LoadService(cfg, WithDiscovery(discover)); err != nil {
+		if err = LoadService(cfg, append([]Option{WithDiscovery(discover)}, opts...)...); err != nil {
 			return
 		}
 	}
@@ -81,27 +94,52 @@ func LoadService(config *Config, opts ...Option) (err error) {
 }
 
 type Config struct {
-	ServiceName   string `validate:"required"`
-	Type          uint8  `validate:"required,oneof=1 2"`
-	Host          string `validate:"required"`
-	Port          int    `validate:"required"`
-	Selector      string `validate:"required,oneof=wr"` // TODO 后续支持其它
+	ServiceName string `validate:"required"`
+	Type        uint8  `validate:"required,oneof=1 2"`
+	Host        string `validate:"required"`
+	Port        int    `validate:"required"`
+	Selector    string `validate:"required,oneof=wr wrr dwrr p2c icmp chash"`
+	// TLSMode is one of plain、tls、mtls、insecure, empty is plain
+	TLSMode string `validate:"omitempty,oneof=plain tls mtls insecure"`
+	// TLSServerName is the server name to verify, default is ServiceName
+	TLSServerName string
+	// CaCrt、ClientPem、ClientKey are inline certificates, the *File ones are preferred and reloaded when changed
 	CaCrt         string
 	ClientPem     string
 	ClientKey     string
+	CaCrtFile     string
+	ClientPemFile string
+	ClientKeyFile string
 	RefreshSecond int
+	DwrrStep      float64
+	DwrrFloor     float64
+	// Zone is the zone of caller, nodes in the same zone are preferred, empty is disabled
+	Zone string
+	// ZoneFallbackRatio falls back to all zones when healthy local weight / registered local weight is lower than it
+	ZoneFallbackRatio float64 `validate:"min=0,max=1"`
+	Outlier           OutlierConfig
+	Breaker           breaker.Config
+	Retry             retry.Config
+	Transport         servicer.TransportConfig
+	// Sign signs the requests to service with HMAC, empty Secret is disabled
+	Sign signature.Config
 }
 
 type Service struct {
 	sync.RWMutex
 	selector        selector.Selector
 	selectorNewNode selector.NewNodeFunc
+	localSelector   selector.Selector
+	preferLocal     int32
 	adjusting       int32
 	updateTime      time.Time
+	resync          int32
+	outlier         *outlierDetector
+	logger          logger.Logger
 	discovery       registry.Discovery
-	caCrt           []byte
-	clientPem       []byte
-	clientKey       []byte
+	handles         sync.Map
+	certs           *certLoader
+	tlsConfig       *tls.Config
 	config          *Config
 }
 
@@ -111,13 +149,14 @@ func WithDiscovery(discovery registry.Discovery) Option {
 	return func(s *Service) { s.discovery = discovery }
 }
 
+func WithLogger(l logger.Logger) Option {
+	return func(s *Service) { s.logger = l }
+}
+
 func NewService(config *Config, opts ...Option) (*Service, error) {
 	s := &Service{
 		adjusting: 0,
 		config:    config,
-		caCrt:     []byte(config.CaCrt),
-		clientPem: []byte(config.ClientPem),
-		clientKey: []byte(config.ClientKey),
 	}
 
 	for _, o := range opts {
@@ -128,6 +167,14 @@ func NewService(config *Config, opts ...Option) (*Service, error) {
 		return nil, err
 	}
 
+	if err := s.initTLS(); err != nil {
+		return nil, err
+	}
+
+	if config.Outlier.enabled() {
+		s.outlier = newOutlierDetector(config.Outlier)
+	}
+
 	if err := s.initSelector(); err != nil {
 		return nil, err
 	}
@@ -159,9 +206,10 @@ func (s *Service) Pick(ctx context.Context) (node *servicer.Node, err error) {
 		return
 	}
 
+	s.recoverOutlier(ctx)
 	s.adjustSelectorNode()
 
-	target, err := s.selector.Select()
+	target, err := s.selectNode(ctx)
 	if err != nil {
 		return
 	}
@@ -171,6 +219,33 @@ func (s *Service) Pick(ctx context.Context) (node *servicer.Node, err error) {
 	return
 }
 
+func (s *Service) selectNode(ctx context.Context) (selector.Node, error) {
+	sel := s.selector
+	if s.isPreferLocal() {
+		sel = s.localSelector
+	}
+
+	key := servicer.ValueHashKey(ctx)
+	if key == "" {
+		return sel.Select()
+	}
+
+	keySelector, ok := sel.(selector.KeySelector)
+	if !ok {
+		return sel.Select()
+	}
+
+	return keySelector.SelectByKey(key)
+}
+
+// selectors returns all selectors which should be notified of request results
+func (s *Service) selectors() []selector.Selector {
+	if assert.IsNil(s.localSelector) {
+		return []selector.Selector{s.selector}
+	}
+	return []selector.Selector{s.selector, s.localSelector}
+}
+
 func (s *Service) initSelector() (err error) {
 	if s.config.Type != servicer.TypeRegistry {
 		return nil
@@ -180,10 +255,14 @@ func (s *Service) initSelector() (err error) {
 		return errors.New("discovery is nil")
 	}
 
-	switch s.config.Selector {
-	case selector.TypeWR:
-		s.selector = wr.NewSelector(wr.WithServiceName(s.config.ServiceName))
-		s.selectorNewNode = wr.NewNode
+	if s.selector, s.selectorNewNode, err = s.newSelector(); err != nil {
+		return
+	}
+
+	if s.config.Zone != "" {
+		if s.localSelector, _, err = s.newSelector(); err != nil {
+			return
+		}
 	}
 
 	s.adjustSelectorNode()
@@ -191,8 +270,30 @@ func (s *Service) initSelector() (err error) {
 	return nil
 }
 
+func (s *Service) newSelector() (selector.Selector, selector.NewNodeFunc, error) {
+	switch s.config.Selector {
+	case selector.TypeWR:
+		return wr.NewSelector(wr.WithServiceName(s.config.ServiceName)), wr.NewNode, nil
+	case selector.TypeWrr:
+		return wrr.NewSelector(wrr.WithServiceName(s.config.ServiceName)), wrr.NewNode, nil
+	case selector.TypeDwrr:
+		return dwrr.NewSelector(
+			dwrr.WithServiceName(s.config.ServiceName),
+			dwrr.WithStep(s.config.DwrrStep),
+			dwrr.WithFloor(s.config.DwrrFloor)), dwrr.NewNode, nil
+	case selector.TypeP2C:
+		return p2c.NewSelector(p2c.WithServiceName(s.config.ServiceName)), p2c.NewNode, nil
+	case selector.TypeICMP:
+		return icmp.NewSelector(icmp.WithServiceName(s.config.ServiceName)), icmp.NewNode, nil
+	case selector.TypeCHash:
+		return chash.NewSelector(chash.WithServiceName(s.config.ServiceName)), chash.NewNode, nil
+	}
+
+	return nil, nil, errors.New("selector not support: " + s.config.Selector)
+}
+
 func (s *Service) adjustSelectorNode() {
-	if s.discovery.GetUpdateTime().Before(s.updateTime) {
+	if atomic.LoadInt32(&s.resync) == 0 && s.discovery.GetUpdateTime().Before(s.updateTime) {
 		return
 	}
 
@@ -203,58 +304,168 @@ func (s *Service) adjustSelectorNode() {
 	s.Lock()
 	defer s.Unlock()
 
+	atomic.StoreInt32(&s.resync, 0)
+	registered := s.discovery.GetNodes()
+	nowNodes := s.filterEjected(registered)
+
+	s.syncSelectorNode(s.selector, nowNodes)
+
+	if !assert.IsNil(s.localSelector) {
+		s.adjustLocalSelectorNode(registered, nowNodes)
+	}
+
+	s.updateTime = time.Now()
+	atomic.StoreInt32(&s.adjusting, 0)
+}
+
+// syncSelectorNode makes the nodes of sel same as nodes
+func (s *Service) syncSelectorNode(sel selector.Selector, nodes []*registry.Node) {
 	var (
-		address     string
-		host        string
-		port        int
-		nowNodes    = s.discovery.GetNodes()
-		nowMap      = make(map[string]struct{})
-		selectorMap = make(map[string]selector.Node)
+		address string
+		host    string
+		port    int
+		nowMap  = make(map[string]struct{})
 	)
 
-	// selector add new nodes
-	for _, n := range nowNodes {
+	// selector add new nodes, and replace nodes whose weight or meta changed
+	for _, n := range nodes {
 		host = n.Host
 		port = n.Port
 		address = selector.GenerateAddress(host, port)
-		node := s.selectorNewNode(host, port, n.Weight, selector.Meta{})
+		node := s.selectorNewNode(host, port, n.Weight, selector.Meta(n.Meta))
 
 		nowMap[address] = struct{}{}
-		selectorMap[address] = node
 
-		_ = s.selector.AddNode(node)
+		if old, ok := sel.GetNode(host, port); ok &&
+			(nodeWeight(old.Weight()) != nodeWeight(n.Weight) || !reflect.DeepEqual(old.Meta(), node.Meta())) {
+			_ = sel.DeleteNode(host, port)
+		}
+
+		_ = sel.AddNode(node)
 	}
 
 	// selector delete non-existent nodes
-	selectorNodes, _ := s.selector.GetNodes()
+	selectorNodes, _ := sel.GetNodes()
 	for _, n := range selectorNodes {
 		if _, ok := nowMap[n.Address()]; ok {
 			continue
 		}
 		host, port = selector.ExtractAddress(n.Address())
-		_ = s.selector.DeleteNode(host, port)
+		_ = sel.DeleteNode(host, port)
 	}
+}
 
-	s.updateTime = time.Now()
-	atomic.StoreInt32(&s.adjusting, 0)
+// nodeWeight treats negative weight as zero, the node with zero weight gets no new requests
+func nodeWeight(weight int) int {
+	if weight < 0 {
+		return 0
+	}
+	return weight
+}
+
+func (s *Service) Start(ctx context.Context, node *servicer.Node) error {
+	if assert.IsNil(s.selector) {
+		return errors.New("selector is nil")
+	}
+
+	var (
+		address = selector.GenerateAddress(node.Host, node.Port)
+		dones   = make([]func(error), 0)
+	)
+	for _, sel := range s.selectors() {
+		starter, ok := sel.(selector.Starter)
+		if !ok {
+			continue
+		}
+		dones = append(dones, starter.BeforeHandle(address))
+	}
+	if len(dones) == 0 {
+		return nil
+	}
+
+	s.handles.Store(node, func(err error) {
+		for _, done := range dones {
+			done(err)
+		}
+	})
+
+	return nil
 }
 
 func (s *Service) Done(ctx context.Context, node *servicer.Node, err error) error {
 	if assert.IsNil(s.selector) {
 		return errors.New("selector is nil")
 	}
-	s.selector.AfterHandle(selector.GenerateAddress(node.Host, node.Port), err)
+
+	if done, ok := s.handles.LoadAndDelete(node); ok {
+		done.(func(error))(err)
+		s.detectOutlier(ctx, node, err)
+		return nil
+	}
+
+	address := selector.GenerateAddress(node.Host, node.Port)
+	for _, sel := range s.selectors() {
+		sel.AfterHandle(address, err)
+	}
+	s.detectOutlier(ctx, node, err)
+
 	return nil
 }
 
 func (s *Service) GetCaCrt() []byte {
-	return s.caCrt
+	caCrt, _, _ := s.certs.getBytes()
+	return caCrt
 }
 
 func (s *Service) GetClientPem() []byte {
-	return s.clientPem
+	_, clientPem, _ := s.certs.getBytes()
+	return clientPem
 }
 
 func (s *Service) GetClientKey() []byte {
-	return s.clientKey
+	_, _, clientKey := s.certs.getBytes()
+	return clientKey
+}
+
+// GetTLSConfig returns the tls.Config of TLSMode, nil is returned when plain
+func (s *Service) GetTLSConfig() *tls.Config {
+	return s.tlsConfig
+}
+
+func (s *Service) GetBreakerConfig() breaker.Config {
+	return s.config.Breaker
+}
+
+func (s *Service) GetRetryConfig() retry.Config {
+	return s.config.Retry
+}
+
+func (s *Service) GetTransportConfig() servicer.TransportConfig {
+	return s.config.Transport
+}
+
+func (s *Service) GetSignConfig() signature.Config {
+	return s.config.Sign
+}
+
+// GetNodes returns all nodes of service, including the ejected nodes
+func (s *Service) GetNodes() (nodes []*servicer.Node, err error) {
+	switch s.config.Type {
+	case servicer.TypeIPPort:
+		return []*servicer.Node{{Host: s.config.Host, Port: s.config.Port}}, nil
+	case servicer.TypeDomain:
+		var ips []net.IP
+		if ips, err = net.LookupIP(s.config.Host); err != nil {
+			return
+		}
+		for _, ip := range ips {
+			nodes = append(nodes, &servicer.Node{Host: ip.String(), Port: s.config.Port})
+		}
+		return
+	}
+
+	for _, n := range s.discovery.GetNodes() {
+		nodes = append(nodes, &servicer.Node{Host: n.Host, Port: n.Port})
+	}
+	return
 }
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/why444216978/gin-api/library/registry"
+	"github.com/why444216978/gin-api/library/selector"
+	"github.com/why444216978/gin-api/library/servicer"
+)
+
+type mockDiscovery struct {
+	nodes      []*registry.Node
+	updateTime time.Time
+}
+
+func (d *mockDiscovery) GetNodes() []*registry.Node { return d.nodes }
+
+func (d *mockDiscovery) GetUpdateTime() time.Time { return d.updateTime }
+
+func (d *mockDiscovery) Close() error { return nil }
+
+func (d *mockDiscovery) setNodes(nodes []*registry.Node) {
+	d.nodes = nodes
+	d.updateTime = time.Now()
+}
+
+func TestService_adjustSelectorNode(t *testing.T) {
+	convey.Convey("TestService_adjustSelectorNode", t, func() {
+		convey.Convey("update weight", func() {
+			d := &mockDiscovery{}
+			d.setNodes([]*registry.Node{
+				{Host: "127.0.0.1", Port: 80, Weight: 10},
+				{Host: "127.0.0.2", Port: 80, Weight: 10},
+			})
+			s, err := NewService(&Config{
+				ServiceName: "test_service",
+				Type:        servicer.TypeRegistry,
+				Host:        "127.0.0.1",
+				Port:        80,
+				Selector:    selector.TypeWR,
+			}, WithDiscovery(d))
+			assert.Nil(t, err)
+
+			time.Sleep(time.Millisecond)
+			d.setNodes([]*registry.Node{
+				{Host: "127.0.0.1", Port: 80, Weight: 10},
+				{Host: "127.0.0.2", Port: 80, Weight: 1},
+			})
+
+			_, err = s.Pick(context.Background())
+			assert.Nil(t, err)
+
+			node, ok := s.selector.GetNode("127.0.0.2", 80)
+			assert.Equal(t, true, ok)
+			assert.Equal(t, 1, node.Weight())
+
+			for i := 0; i < 100; i++ {
+				_, err := s.Pick(context.Background())
+				assert.Nil(t, err)
+			}
+		})
+		convey.Convey("zero weight drains node", func() {
+			d := &mockDiscovery{}
+			d.setNodes([]*registry.Node{
+				{Host: "127.0.0.1", Port: 80, Weight: 10},
+				{Host: "127.0.0.2", Port: 80, Weight: 10},
+			})
+			s, err := NewService(&Config{
+				ServiceName: "test_service",
+				Type:        servicer.TypeRegistry,
+				Host:        "127.0.0.1",
+				Port:        80,
+				Selector:    selector.TypeWrr,
+			}, WithDiscovery(d))
+			assert.Nil(t, err)
+
+			time.Sleep(time.Millisecond)
+			d.setNodes([]*registry.Node{
+				{Host: "127.0.0.1", Port: 80, Weight: 10},
+				{Host: "127.0.0.2", Port: 80, Weight: 0},
+			})
+
+			for i := 0; i < 10; i++ {
+				node, err := s.Pick(context.Background())
+				assert.Nil(t, err)
+				assert.Equal(t, "127.0.0.1", node.Host)
+			}
+		})
+		convey.Convey("update meta", func() {
+			d := &mockDiscovery{}
+			d.setNodes([]*registry.Node{
+				{Host: "127.0.0.1", Port: 80, Weight: 1, Meta: map[string]string{selector.MetaVersion: "v1"}},
+			})
+			s, err := NewService(&Config{
+				ServiceName: "test_service",
+				Type:        servicer.TypeRegistry,
+				Host:        "127.0.0.1",
+				Port:        80,
+				Selector:    selector.TypeWR,
+			}, WithDiscovery(d))
+			assert.Nil(t, err)
+
+			time.Sleep(time.Millisecond)
+			d.setNodes([]*registry.Node{
+				{Host: "127.0.0.1", Port: 80, Weight: 1, Meta: map[string]string{selector.MetaVersion: "v2"}},
+			})
+
+			_, err = s.Pick(context.Background())
+			assert.Nil(t, err)
+
+			node, ok := s.selector.GetNode("127.0.0.1", 80)
+			assert.Equal(t, true, ok)
+			assert.Equal(t, "v2", node.Meta()[selector.MetaVersion])
+		})
+		convey.Convey("delete node", func() {
+			d := &mockDiscovery{}
+			d.setNodes([]*registry.Node{
+				{Host: "127.0.0.1", Port: 80, Weight: 1},
+				{Host: "127.0.0.2", Port: 80, Weight: 1},
+			})
+			s, err := NewService(&Config{
+				ServiceName: "test_service",
+				Type:        servicer.TypeRegistry,
+				Host:        "127.0.0.1",
+				Port:        80,
+				Selector:    selector.TypeWR,
+			}, WithDiscovery(d))
+			assert.Nil(t, err)
+
+			time.Sleep(time.Millisecond)
+			d.setNodes([]*registry.Node{
+				{Host: "127.0.0.1", Port: 80, Weight: 1},
+			})
+
+			for i := 0; i < 10; i++ {
+				node, err := s.Pick(context.Background())
+				assert.Nil(t, err)
+				assert.Equal(t, "127.0.0.1", node.Host)
+			}
+		})
+	})
+}
+
+func TestService_GetNodes(t *testing.T) {
+	convey.Convey("TestService_GetNodes", t, func() {
+		convey.Convey("ip port", func() {
+			s, err := NewService(&Config{
+				ServiceName: "test_service",
+				Type:        servicer.TypeIPPort,
+				Host:        "127.0.0.1",
+				Port:        80,
+				Selector:    selector.TypeWR,
+			})
+			assert.Nil(t, err)
+
+			nodes, err := s.GetNodes()
+			assert.Nil(t, err)
+			assert.Equal(t, []*servicer.Node{{Host: "127.0.0.1", Port: 80}}, nodes)
+		})
+		convey.Convey("registry including ejected nodes", func() {
+			d := &mockDiscovery{}
+			d.setNodes([]*registry.Node{
+				{Host: "127.0.0.1", Port: 80, Weight: 1},
+				{Host: "127.0.0.2", Port: 80, Weight: 1},
+			})
+			s, err := NewService(&Config{
+				ServiceName: "test_service",
+				Type:        servicer.TypeRegistry,
+				Host:        "127.0.0.1",
+				Port:        80,
+				Selector:    selector.TypeWR,
+				Outlier:     OutlierConfig{ConsecutiveErrors: 1, MaxEjectionPercent: 50},
+			}, WithDiscovery(d))
+			assert.Nil(t, err)
+
+			_ = s.Done(context.Background(), &servicer.Node{Host: "127.0.0.2", Port: 80}, assert.AnError)
+
+			nodes, err := s.GetNodes()
+			assert.Nil(t, err)
+			assert.Len(t, nodes, 2)
+		})
+	})
+}
@@ -0,0 +1,269 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/why444216978/go-util/assert"
+
+	"github.com/why444216978/gin-api/library/logger"
+	"github.com/why444216978/gin-api/library/servicer"
+)
+
+// certReloadInterval is the min interval of checking whether the certificate files changed
+const certReloadInterval = 10 * time.Second
+
+// certFile is the certificate loaded from file or inline content
+type certFile struct {
+	path    string
+	inline  []byte
+	modTime time.Time
+}
+
+func (f *certFile) read() ([]byte, error) {
+	if f.path == "" {
+		return f.inline, nil
+	}
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+	f.modTime = info.ModTime()
+
+	return content, nil
+}
+
+func (f *certFile) changed() bool {
+	if f.path == "" {
+		return false
+	}
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return false
+	}
+	return !info.ModTime().Equal(f.modTime)
+}
+
+// certLoader loads the certificates of service, and reloads them when the files change
+type certLoader struct {
+	lock      sync.RWMutex
+	mode      string
+	caCrt     *certFile
+	clientPem *certFile
+	clientKey *certFile
+	caBytes   []byte
+	pemBytes  []byte
+	keyBytes  []byte
+	pool      *x509.CertPool
+	cert      *tls.Certificate
+	checkAt   time.Time
+}
+
+func newCertLoader(config *Config) (*certLoader, error) {
+	l := &certLoader{
+		mode:      config.TLSMode,
+		caCrt:     &certFile{path: config.CaCrtFile, inline: []byte(config.CaCrt)},
+		clientPem: &certFile{path: config.ClientPemFile, inline: []byte(config.ClientPem)},
+		clientKey: &certFile{path: config.ClientKeyFile, inline: []byte(config.ClientKey)},
+	}
+
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// load reads and parses all certificates, the old ones are kept if failed
+func (l *certLoader) load() error {
+	caBytes, err := l.caCrt.read()
+	if err != nil {
+		return err
+	}
+	pemBytes, err := l.clientPem.read()
+	if err != nil {
+		return err
+	}
+	keyBytes, err := l.clientKey.read()
+	if err != nil {
+		return err
+	}
+
+	pool, cert, err := l.parse(caBytes, pemBytes, keyBytes)
+	if err != nil {
+		return err
+	}
+
+	l.caBytes, l.pemBytes, l.keyBytes = caBytes, pemBytes, keyBytes
+	l.pool, l.cert = pool, cert
+	l.checkAt = time.Now().Add(certReloadInterval)
+
+	return nil
+}
+
+// parse parses the certificates, nothing is parsed when plain
+func (l *certLoader) parse(caBytes, pemBytes, keyBytes []byte) (pool *x509.CertPool, cert *tls.Certificate, err error) {
+	if l.plain() {
+		return
+	}
+
+	if len(caBytes) > 0 {
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caBytes) {
+			return nil, nil, errors.New("invalid ca crt")
+		}
+	}
+
+	if len(pemBytes) > 0 || len(keyBytes) > 0 {
+		c, err := tls.X509KeyPair(pemBytes, keyBytes)
+		if err != nil {
+			return nil, nil, errors.New("client pem error " + err.Error())
+		}
+		cert = &c
+	}
+
+	if l.mode == servicer.TLSModeMTLS && cert == nil {
+		return nil, nil, errors.New("mtls needs client pem and key")
+	}
+
+	return
+}
+
+func (l *certLoader) plain() bool {
+	return l.mode == "" || l.mode == servicer.TLSModePlain
+}
+
+// reload loads the certificates again when the files change, it checks at most once in certReloadInterval
+func (l *certLoader) reload() error {
+	l.lock.RLock()
+	checkAt := l.checkAt
+	l.lock.RUnlock()
+	if time.Now().Before(checkAt) {
+		return nil
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if time.Now().Before(l.checkAt) {
+		return nil
+	}
+	l.checkAt = time.Now().Add(certReloadInterval)
+
+	if !l.caCrt.changed() && !l.clientPem.changed() && !l.clientKey.changed() {
+		return nil
+	}
+
+	return l.load()
+}
+
+func (l *certLoader) getPool() *x509.CertPool {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.pool
+}
+
+func (l *certLoader) getCert() *tls.Certificate {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.cert
+}
+
+func (l *certLoader) getBytes() (caCrt, clientPem, clientKey []byte) {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	return l.caBytes, l.pemBytes, l.keyBytes
+}
+
+// tlsConfig builds the tls.Config of mode, the certificates are read on every handshake for hot reload,
+// nil is returned when plain.
+func (l *certLoader) tlsConfig(serverName string, onReloadErr func(error)) *tls.Config {
+	if l.plain() {
+		return nil
+	}
+
+	reload := func() {
+		if err := l.reload(); err != nil && onReloadErr != nil {
+			onReloadErr(err)
+		}
+	}
+
+	cfg := &tls.Config{
+		ServerName: serverName,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			reload()
+			if cert := l.getCert(); cert != nil {
+				return cert, nil
+			}
+			return &tls.Certificate{}, nil
+		},
+	}
+
+	if l.mode == servicer.TLSModeInsecure {
+		cfg.InsecureSkipVerify = true
+		return cfg
+	}
+
+	// 服务端证书由自定义CA校验，CA可热更新
+	if l.getPool() != nil {
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			reload()
+			return verifyConnection(cs, l.getPool())
+		}
+	}
+
+	return cfg
+}
+
+func verifyConnection(cs tls.ConnectionState, pool *x509.CertPool) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("no peer certificate")
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         pool,
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+func (s *Service) initTLS() (err error) {
+	if s.certs, err = newCertLoader(s.config); err != nil {
+		return
+	}
+
+	serverName := s.config.TLSServerName
+	if serverName == "" {
+		serverName = s.config.ServiceName
+	}
+
+	s.tlsConfig = s.certs.tlsConfig(serverName, func(err error) {
+		if assert.IsNil(s.logger) {
+			return
+		}
+		s.logger.Error(context.Background(), "reload certificate error",
+			logger.Reflect(logger.ServiceName, s.Name()),
+			logger.Error(err))
+	})
+
+	return
+}
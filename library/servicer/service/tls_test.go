@@ -0,0 +1,183 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/why444216978/gin-api/library/selector"
+	"github.com/why444216978/gin-api/library/servicer"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newTestCert(t *testing.T, cn string, parent *testCert, isCA bool) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		DNSNames:              []string{cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	parentCert, parentKey := tpl, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, parentCert, &key.PublicKey, parentKey)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func TestService_GetTLSConfig(t *testing.T) {
+	convey.Convey("TestService_GetTLSConfig", t, func() {
+		ca := newTestCert(t, "test_ca", nil, true)
+		serverCert := newTestCert(t, "test_service", ca, false)
+		clientCert := newTestCert(t, "test_client", ca, false)
+
+		newConfig := func(mode string) *Config {
+			return &Config{
+				ServiceName: "test_service",
+				Type:        servicer.TypeIPPort,
+				Host:        "127.0.0.1",
+				Port:        80,
+				Selector:    selector.TypeWR,
+				TLSMode:     mode,
+			}
+		}
+
+		convey.Convey("plain", func() {
+			cfg := newConfig("")
+			cfg.ClientPem = "invalid"
+			s, err := NewService(cfg)
+			assert.Nil(t, err)
+			assert.Nil(t, s.GetTLSConfig())
+			assert.Equal(t, []byte("invalid"), s.GetClientPem())
+		})
+		convey.Convey("mtls without client cert", func() {
+			_, err := NewService(newConfig(servicer.TLSModeMTLS))
+			assert.NotNil(t, err)
+		})
+		convey.Convey("invalid ca", func() {
+			cfg := newConfig(servicer.TLSModeTLS)
+			cfg.CaCrt = "invalid"
+			_, err := NewService(cfg)
+			assert.NotNil(t, err)
+		})
+		convey.Convey("insecure", func() {
+			s, err := NewService(newConfig(servicer.TLSModeInsecure))
+			assert.Nil(t, err)
+			assert.Equal(t, true, s.GetTLSConfig().InsecureSkipVerify)
+		})
+		convey.Convey("mtls from files and reload", func() {
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+			}))
+			pool := x509.NewCertPool()
+			pool.AddCert(ca.cert)
+			cert, err := tls.X509KeyPair(serverCert.certPEM, serverCert.keyPEM)
+			assert.Nil(t, err)
+			server.TLS = &tls.Config{
+				Certificates: []tls.Certificate{cert},
+				ClientCAs:    pool,
+				ClientAuth:   tls.RequireAndVerifyClientCert,
+			}
+			server.StartTLS()
+			defer server.Close()
+
+			dir, err := ioutil.TempDir("", "tls")
+			assert.Nil(t, err)
+			defer os.RemoveAll(dir)
+			write := func(name string, content []byte) string {
+				f := filepath.Join(dir, name)
+				assert.Nil(t, ioutil.WriteFile(f, content, 0600))
+				return f
+			}
+
+			cfg := newConfig(servicer.TLSModeMTLS)
+			cfg.CaCrtFile = write("ca.crt", ca.certPEM)
+			cfg.ClientPemFile = write("client.pem", clientCert.certPEM)
+			cfg.ClientKeyFile = write("client.key", clientCert.keyPEM)
+			s, err := NewService(cfg)
+			assert.Nil(t, err)
+
+			get := func() (string, error) {
+				c := &http.Client{Transport: &http.Transport{TLSClientConfig: s.GetTLSConfig()}}
+				resp, err := c.Get(server.URL)
+				if err != nil {
+					return "", err
+				}
+				defer resp.Body.Close()
+				b, err := ioutil.ReadAll(resp.Body)
+				return string(b), err
+			}
+			cn, err := get()
+			assert.Nil(t, err)
+			assert.Equal(t, "test_client", cn)
+
+			// reload the new client certificate
+			newClientCert := newTestCert(t, "test_client_new", ca, false)
+			_ = write("client.pem", newClientCert.certPEM)
+			_ = write("client.key", newClientCert.keyPEM)
+			future := time.Now().Add(time.Minute)
+			assert.Nil(t, os.Chtimes(cfg.ClientPemFile, future, future))
+			assert.Nil(t, os.Chtimes(cfg.ClientKeyFile, future, future))
+			s.certs.checkAt = time.Now()
+
+			cn, err = get()
+			assert.Nil(t, err)
+			assert.Equal(t, "test_client_new", cn)
+			assert.Equal(t, newClientCert.certPEM, s.GetClientPem())
+		})
+		convey.Convey("reject unknown server", func() {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer server.Close()
+
+			cfg := newConfig(servicer.TLSModeTLS)
+			cfg.CaCrt = string(ca.certPEM)
+			s, err := NewService(cfg)
+			assert.Nil(t, err)
+
+			c := &http.Client{Transport: &http.Transport{TLSClientConfig: s.GetTLSConfig()}}
+			_, err = c.Get(server.URL)
+			assert.NotNil(t, err)
+		})
+	})
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"sync/atomic"
+
+	"github.com/why444216978/gin-api/library/registry"
+	"github.com/why444216978/gin-api/library/selector"
+)
+
+// adjustLocalSelectorNode syncs the healthy nodes in the same zone to localSelector,
+// and prefers them when healthy local weight / registered local weight is not lower than ZoneFallbackRatio.
+// registered is the nodes from discovery, healthy is the nodes after ejecting outliers.
+func (s *Service) adjustLocalSelectorNode(registered, healthy []*registry.Node) {
+	var (
+		localNodes       = make([]*registry.Node, 0)
+		healthyWeight    int
+		registeredWeight int
+	)
+
+	for _, n := range registered {
+		if n.Meta[selector.MetaZone] != s.config.Zone {
+			continue
+		}
+		registeredWeight = registeredWeight + nodeWeight(n.Weight)
+	}
+
+	for _, n := range healthy {
+		if n.Meta[selector.MetaZone] != s.config.Zone {
+			continue
+		}
+		localNodes = append(localNodes, n)
+		healthyWeight = healthyWeight + nodeWeight(n.Weight)
+	}
+
+	s.syncSelectorNode(s.localSelector, localNodes)
+
+	preferLocal := int32(0)
+	if healthyWeight > 0 && float64(healthyWeight) >= float64(registeredWeight)*s.config.ZoneFallbackRatio {
+		preferLocal = 1
+	}
+	atomic.StoreInt32(&s.preferLocal, preferLocal)
+}
+
+func (s *Service) isPreferLocal() bool {
+	return atomic.LoadInt32(&s.preferLocal) == 1
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/why444216978/gin-api/library/registry"
+	"github.com/why444216978/gin-api/library/selector"
+	"github.com/why444216978/gin-api/library/servicer"
+)
+
+func zoneNode(host, zone string, weight int) *registry.Node {
+	return &registry.Node{
+		Host:   host,
+		Port:   80,
+		Weight: weight,
+		Meta:   map[string]string{selector.MetaZone: zone},
+	}
+}
+
+func TestService_Zone(t *testing.T) {
+	convey.Convey("TestService_Zone", t, func() {
+		newService := func(d registry.Discovery, ratio float64) *Service {
+			s, err := NewService(&Config{
+				ServiceName:       "test_service",
+				Type:              servicer.TypeRegistry,
+				Host:              "127.0.0.1",
+				Port:              80,
+				Selector:          selector.TypeWrr,
+				Zone:              "bj",
+				ZoneFallbackRatio: ratio,
+			}, WithDiscovery(d))
+			assert.Nil(t, err)
+			return s
+		}
+		pickHosts := func(s *Service) map[string]int {
+			res := map[string]int{}
+			for i := 0; i < 10; i++ {
+				node, err := s.Pick(context.Background())
+				assert.Nil(t, err)
+				res[node.Host]++
+			}
+			return res
+		}
+
+		convey.Convey("prefer local zone", func() {
+			d := &mockDiscovery{}
+			d.setNodes([]*registry.Node{
+				zoneNode("127.0.0.1", "bj", 1),
+				zoneNode("127.0.0.2", "sh", 1),
+			})
+			s := newService(d, 0.3)
+			assert.Equal(t, map[string]int{"127.0.0.1": 10}, pickHosts(s))
+		})
+		convey.Convey("prefer local zone when local nodes are all healthy", func() {
+			d := &mockDiscovery{}
+			d.setNodes([]*registry.Node{
+				zoneNode("127.0.0.1", "bj", 1),
+				zoneNode("127.0.0.2", "sh", 2),
+				zoneNode("127.0.0.3", "sh", 2),
+			})
+			s := newService(d, 0.3)
+			assert.Equal(t, map[string]int{"127.0.0.1": 10}, pickHosts(s))
+		})
+		convey.Convey("fallback when local capacity is low", func() {
+			registered := []*registry.Node{
+				zoneNode("127.0.0.1", "bj", 1),
+				zoneNode("127.0.0.2", "bj", 2),
+				zoneNode("127.0.0.3", "sh", 1),
+			}
+			d := &mockDiscovery{}
+			d.setNodes(registered)
+			s := newService(d, 0.5)
+			assert.Equal(t, true, s.isPreferLocal())
+
+			// 127.0.0.2 被摘除，本地健康权重 1/3 低于 0.5
+			s.adjustLocalSelectorNode(registered, []*registry.Node{registered[0], registered[2]})
+			assert.Equal(t, false, s.isPreferLocal())
+
+			s.adjustLocalSelectorNode(registered, []*registry.Node{registered[1], registered[2]})
+			assert.Equal(t, true, s.isPreferLocal())
+		})
+		convey.Convey("fallback when no local node", func() {
+			d := &mockDiscovery{}
+			d.setNodes([]*registry.Node{
+				zoneNode("127.0.0.2", "sh", 1),
+			})
+			s := newService(d, 0)
+			assert.Equal(t, map[string]int{"127.0.0.2": 10}, pickHosts(s))
+		})
+		convey.Convey("done notifies all selectors", func() {
+			d := &mockDiscovery{}
+			d.setNodes([]*registry.Node{
+				zoneNode("127.0.0.1", "bj", 1),
+			})
+			s := newService(d, 0)
+
+			node, _ := s.Pick(context.Background())
+			_ = s.Done(context.Background(), node, nil)
+
+			for _, sel := range s.selectors() {
+				n, _ := sel.GetNode("127.0.0.1", 80)
+				assert.Equal(t, selector.Statistics{Success: 1}, n.Statistics())
+			}
+		})
+	})
+}
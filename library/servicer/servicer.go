@@ -11,11 +11,56 @@ const (
 	TypeDomain   uint8 = 3
 )
 
+const (
+	TLSModePlain    = "plain"
+	TLSModeTLS      = "tls"
+	TLSModeMTLS     = "mtls"
+	TLSModeInsecure = "insecure"
+)
+
+type contextKey uint64
+
+const (
+	contextHashKey contextKey = iota
+)
+
+// WithHashKey inject the key of consistent hash to context,
+// Pick selects the node by it if the selector supports
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, contextHashKey, key)
+}
+
+// ValueHashKey extract the key of consistent hash from context
+func ValueHashKey(ctx context.Context) string {
+	val := ctx.Value(contextHashKey)
+	key, ok := val.(string)
+	if !ok {
+		return ""
+	}
+	return key
+}
+
 type Node struct {
 	Host string
 	Port int
 }
 
+// TransportConfig is the config of the long-lived transport of every node
+type TransportConfig struct {
+	// MaxIdleConns is the max idle connections of every node
+	MaxIdleConns int `validate:"min=0"`
+	// MaxConns is the max connections of every node, zero means no limit
+	MaxConns int `validate:"min=0"`
+	// IdleConnTimeoutSecond is the max time an idle connection keeps
+	IdleConnTimeoutSecond int `validate:"min=0"`
+	// DialTimeoutMillisecond is the timeout of establishing connection
+	DialTimeoutMillisecond int `validate:"min=0"`
+	// KeepAliveSecond is the interval of TCP keep-alive
+	KeepAliveSecond int `validate:"min=0"`
+	// TLSHandshakeTimeoutMillisecond is the timeout of TLS handshake
+	TLSHandshakeTimeoutMillisecond int `validate:"min=0"`
+}
+
 type DoneInfo struct {
 	Node *Node
 	Err  error
@@ -51,3 +96,15 @@ type Servicer interface {
 	GetClientPem() []byte
 	GetClientKey() []byte
 }
+
+// Starter is implemented by the Servicer which needs to know when a request to node starts,
+// such as tracking in-flight requests, Done is still called when the request finishes.
+type Starter interface {
+	Start(ctx context.Context, node *Node) error
+}
+
+// NodeGetter is implemented by the Servicer which can list all of its nodes,
+// such as the gRPC resolver and the cleaning of HTTP transports use it.
+type NodeGetter interface {
+	GetNodes() ([]*Node, error)
+}
@@ -0,0 +1,80 @@
+package signature
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const nonceKeyPrefix = "signature:nonce:"
+
+// NonceStore rejects replayed requests
+type NonceStore interface {
+	// Add saves nonce for ttl, false is returned if nonce exists
+	Add(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+}
+
+var _ NonceStore = (*MemoryNonceStore)(nil)
+
+// MemoryNonceStore is NonceStore in process memory, it is only for single instance
+type MemoryNonceStore struct {
+	lock    sync.Mutex
+	nonces  map[string]time.Time
+	cleanAt time.Time
+}
+
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{
+		nonces: make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryNonceStore) Add(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	s.clean(now, ttl)
+
+	if expireAt, ok := s.nonces[nonce]; ok && now.Before(expireAt) {
+		return false, nil
+	}
+	s.nonces[nonce] = now.Add(ttl)
+
+	return true, nil
+}
+
+// clean deletes the expired nonces, it runs at most once in ttl
+func (s *MemoryNonceStore) clean(now time.Time, ttl time.Duration) {
+	if now.Before(s.cleanAt) {
+		return
+	}
+	s.cleanAt = now.Add(ttl)
+
+	for nonce, expireAt := range s.nonces {
+		if !now.Before(expireAt) {
+			delete(s.nonces, nonce)
+		}
+	}
+}
+
+var _ NonceStore = (*RedisNonceStore)(nil)
+
+// RedisNonceStore is NonceStore shared by instances in Redis
+type RedisNonceStore struct {
+	c *redis.Client
+}
+
+func NewRedisNonceStore(c *redis.Client) (*RedisNonceStore, error) {
+	if c == nil {
+		return nil, errors.New("redis client is nil")
+	}
+	return &RedisNonceStore{c: c}, nil
+}
+
+func (s *RedisNonceStore) Add(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	return s.c.SetNX(ctx, nonceKeyPrefix+nonce, 1, ttl).Result()
+}
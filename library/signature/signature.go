@@ -0,0 +1,196 @@
+// signature is HMAC signing of service-to-service requests
+package signature
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderKeyID     = "X-Signature-Key-Id"
+	HeaderTimestamp = "X-Signature-Timestamp"
+	HeaderNonce     = "X-Signature-Nonce"
+	HeaderSignature = "X-Signature"
+	// HeaderBodyHash is UnsignedPayload when the body is not covered by the signature
+	HeaderBodyHash = "X-Signature-Body-Hash"
+)
+
+// UnsignedPayload is the body hash marker of streaming body, which is signed without reading the body
+const UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+var (
+	ErrMissing   = errors.New("signature headers missing")
+	ErrKey       = errors.New("signature key not found")
+	ErrExpired   = errors.New("signature timestamp out of skew window")
+	ErrSignature = errors.New("signature mismatch")
+	ErrReplay    = errors.New("signature nonce replayed")
+	ErrUnsigned  = errors.New("signature unsigned payload not allowed")
+)
+
+// Config is the signing config of a service, it is disabled when Secret is empty
+type Config struct {
+	// KeyID is the identity of caller, the callee looks up the secret by it
+	KeyID string
+	// Secret is the HMAC secret shared with callee
+	Secret string
+}
+
+func (c Config) Enabled() bool {
+	return c.Secret != ""
+}
+
+// Sign returns the hex HMAC-SHA256 of method, uri, body hash, timestamp and nonce
+func Sign(secret []byte, method, uri, bodyHash string, timestamp int64, nonce string) string {
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write([]byte(strings.Join([]string{
+		strings.ToUpper(method),
+		uri,
+		bodyHash,
+		strconv.FormatInt(timestamp, 10),
+		nonce,
+	}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// BodyHash returns the hex SHA256 of body
+func BodyHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// NewNonce returns a random nonce
+func NewNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// SignRequest sets the signature headers of req, the body is read and restored.
+// The streaming body which can't be replayed by GetBody is signed as UnsignedPayload without buffering.
+func SignRequest(req *http.Request, keyID string, secret []byte) error {
+	bodyHash := UnsignedPayload
+	if !isStream(req) {
+		body, err := readBody(req)
+		if err != nil {
+			return err
+		}
+		bodyHash = BodyHash(body)
+	}
+
+	nonce, err := NewNonce()
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now().Unix()
+
+	req.Header.Set(HeaderKeyID, keyID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderBodyHash, bodyHash)
+	req.Header.Set(HeaderSignature, Sign(secret, req.Method, req.URL.RequestURI(), bodyHash, timestamp, nonce))
+
+	return nil
+}
+
+// Verified is the signature headers of a verified request
+type Verified struct {
+	KeyID     string
+	Timestamp int64
+	Nonce     string
+	// UnsignedPayload is true when the body is not covered by the signature
+	UnsignedPayload bool
+}
+
+// VerifyRequest verifies the signature headers of req and the clock skew, the body is read and restored
+// unless it is signed as UnsignedPayload, secret looks up the secret by key id, replay is not checked here.
+func VerifyRequest(req *http.Request, secret func(keyID string) ([]byte, bool), skew time.Duration) (*Verified, error) {
+	v := &Verified{
+		KeyID: req.Header.Get(HeaderKeyID),
+		Nonce: req.Header.Get(HeaderNonce),
+	}
+	sign := req.Header.Get(HeaderSignature)
+	ts := req.Header.Get(HeaderTimestamp)
+	if v.KeyID == "" || v.Nonce == "" || sign == "" || ts == "" {
+		return nil, ErrMissing
+	}
+
+	timestamp, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, ErrMissing
+	}
+	v.Timestamp = timestamp
+
+	diff := time.Since(time.Unix(timestamp, 0))
+	if diff > skew || diff < -skew {
+		return nil, ErrExpired
+	}
+
+	key, ok := secret(v.KeyID)
+	if !ok {
+		return nil, ErrKey
+	}
+
+	bodyHash := UnsignedPayload
+	if req.Header.Get(HeaderBodyHash) == UnsignedPayload {
+		v.UnsignedPayload = true
+	} else {
+		// 不信任请求头中的hash，始终按实际body计算
+		body, err := readBody(req)
+		if err != nil {
+			return nil, err
+		}
+		bodyHash = BodyHash(body)
+	}
+
+	expect := Sign(key, req.Method, req.URL.RequestURI(), bodyHash, timestamp, v.Nonce)
+	if !hmac.Equal([]byte(expect), []byte(sign)) {
+		return nil, ErrSignature
+	}
+
+	return v, nil
+}
+
+// isStream reports whether the body of req can only be read once
+func isStream(req *http.Request) bool {
+	return req.Body != nil && req.Body != http.NoBody && req.GetBody == nil
+}
+
+// readBody reads the body of req and restores it
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return ioutil.ReadAll(rc)
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	_ = req.Body.Close()
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+
+	return body, nil
+}
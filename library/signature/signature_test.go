@@ -0,0 +1,165 @@
+package signature
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	redismock "github.com/go-redis/redismock/v8"
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+)
+
+var testSecret = func(keyID string) ([]byte, bool) {
+	if keyID == "caller" {
+		return []byte("secret"), true
+	}
+	return nil, false
+}
+
+// onceReader records whether the streaming body is read
+type onceReader struct {
+	io.Reader
+	read bool
+}
+
+func (r *onceReader) Read(p []byte) (int, error) {
+	r.read = true
+	return r.Reader.Read(p)
+}
+
+func (r *onceReader) Close() error { return nil }
+
+func newSignedRequest(t *testing.T, body string) *http.Request {
+	req, err := http.NewRequest(http.MethodPost, "http://127.0.0.1/test?a=1", bytes.NewReader([]byte(body)))
+	assert.Nil(t, err)
+	assert.Nil(t, SignRequest(req, "caller", []byte("secret")))
+	return req
+}
+
+func TestSignRequest(t *testing.T) {
+	convey.Convey("TestSignRequest", t, func() {
+		convey.Convey("body restored", func() {
+			req := newSignedRequest(t, `{"a":1}`)
+			b, err := ioutil.ReadAll(req.Body)
+			assert.Nil(t, err)
+			assert.Equal(t, `{"a":1}`, string(b))
+			assert.Equal(t, "caller", req.Header.Get(HeaderKeyID))
+			assert.NotEmpty(t, req.Header.Get(HeaderNonce))
+			assert.NotEmpty(t, req.Header.Get(HeaderSignature))
+		})
+		convey.Convey("stream body unsigned", func() {
+			body := &onceReader{Reader: bytes.NewReader([]byte("stream"))}
+			req, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1/test", body)
+			assert.Nil(t, req.GetBody)
+			assert.Nil(t, SignRequest(req, "caller", []byte("secret")))
+			assert.Equal(t, UnsignedPayload, req.Header.Get(HeaderBodyHash))
+			assert.Equal(t, false, body.read)
+
+			v, err := VerifyRequest(req, testSecret, time.Minute)
+			assert.Nil(t, err)
+			assert.Equal(t, true, v.UnsignedPayload)
+			assert.Equal(t, false, body.read)
+
+			b, _ := ioutil.ReadAll(req.Body)
+			assert.Equal(t, "stream", string(b))
+		})
+	})
+}
+
+func TestVerifyRequest(t *testing.T) {
+	convey.Convey("TestVerifyRequest", t, func() {
+		convey.Convey("success", func() {
+			req := newSignedRequest(t, `{"a":1}`)
+			v, err := VerifyRequest(req, testSecret, time.Minute)
+			assert.Nil(t, err)
+			assert.Equal(t, "caller", v.KeyID)
+
+			b, _ := ioutil.ReadAll(req.Body)
+			assert.Equal(t, `{"a":1}`, string(b))
+		})
+		convey.Convey("missing", func() {
+			req, _ := http.NewRequest(http.MethodGet, "http://127.0.0.1/test", nil)
+			_, err := VerifyRequest(req, testSecret, time.Minute)
+			assert.Equal(t, ErrMissing, err)
+		})
+		convey.Convey("unknown key", func() {
+			req := newSignedRequest(t, "")
+			req.Header.Set(HeaderKeyID, "unknown")
+			_, err := VerifyRequest(req, testSecret, time.Minute)
+			assert.Equal(t, ErrKey, err)
+		})
+		convey.Convey("expired", func() {
+			req := newSignedRequest(t, "")
+			req.Header.Set(HeaderTimestamp, strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10))
+			_, err := VerifyRequest(req, testSecret, time.Minute)
+			assert.Equal(t, ErrExpired, err)
+		})
+		convey.Convey("tampered body", func() {
+			req := newSignedRequest(t, `{"a":1}`)
+			req.Body = ioutil.NopCloser(bytes.NewReader([]byte(`{"a":2}`)))
+			req.GetBody = nil
+			_, err := VerifyRequest(req, testSecret, time.Minute)
+			assert.Equal(t, ErrSignature, err)
+		})
+		convey.Convey("forged unsigned payload", func() {
+			req := newSignedRequest(t, `{"a":1}`)
+			req.Header.Set(HeaderBodyHash, UnsignedPayload)
+			_, err := VerifyRequest(req, testSecret, time.Minute)
+			assert.Equal(t, ErrSignature, err)
+		})
+		convey.Convey("tampered path", func() {
+			req := newSignedRequest(t, "")
+			req.URL.RawQuery = "a=2"
+			_, err := VerifyRequest(req, testSecret, time.Minute)
+			assert.Equal(t, ErrSignature, err)
+		})
+	})
+}
+
+func TestMemoryNonceStore(t *testing.T) {
+	convey.Convey("TestMemoryNonceStore", t, func() {
+		convey.Convey("success", func() {
+			s := NewMemoryNonceStore()
+			ok, err := s.Add(context.Background(), "nonce", time.Millisecond*10)
+			assert.Nil(t, err)
+			assert.Equal(t, true, ok)
+
+			ok, _ = s.Add(context.Background(), "nonce", time.Millisecond*10)
+			assert.Equal(t, false, ok)
+
+			time.Sleep(time.Millisecond * 20)
+			ok, _ = s.Add(context.Background(), "nonce", time.Millisecond*10)
+			assert.Equal(t, true, ok)
+		})
+	})
+}
+
+func TestRedisNonceStore(t *testing.T) {
+	convey.Convey("TestRedisNonceStore", t, func() {
+		convey.Convey("nil client", func() {
+			_, err := NewRedisNonceStore(nil)
+			assert.NotNil(t, err)
+		})
+		convey.Convey("success", func() {
+			c, mock := redismock.NewClientMock()
+			s, err := NewRedisNonceStore(c)
+			assert.Nil(t, err)
+
+			mock.ExpectSetNX(nonceKeyPrefix+"nonce", 1, time.Minute).SetVal(true)
+			mock.ExpectSetNX(nonceKeyPrefix+"nonce", 1, time.Minute).SetVal(false)
+
+			ok, err := s.Add(context.Background(), "nonce", time.Minute)
+			assert.Nil(t, err)
+			assert.Equal(t, true, ok)
+			ok, err = s.Add(context.Background(), "nonce", time.Minute)
+			assert.Nil(t, err)
+			assert.Equal(t, false, ok)
+		})
+	})
+}
@@ -2,6 +2,7 @@ package cmux
 
 import (
 	"context"
+	"errors"
 	"net"
 	"net/http"
 
@@ -12,6 +13,7 @@ import (
 	"google.golang.org/protobuf/encoding/protojson"
 
 	"github.com/why444216978/gin-api/library/logger"
+	"github.com/why444216978/gin-api/library/servicer"
 	"github.com/why444216978/gin-api/server"
 	serverGRPC "github.com/why444216978/gin-api/server/grpc"
 )
@@ -24,10 +26,22 @@ type Option struct {
 	logger       logger.Logger
 	registerHTTP RegisterHTTP
 	httpServer   *http.Server
+	serverConfig serverGRPC.ServerConfig
+	clientConfig serverGRPC.ClientConfig
 }
 
 type OptionFunc func(*Option)
 
+// WithServerConfig sets the config of gRPC server, TLS is not supported because cmux matches the plaintext
+func WithServerConfig(cfg serverGRPC.ServerConfig) OptionFunc {
+	return func(s *Option) { s.serverConfig = cfg }
+}
+
+// WithClientConfig sets the config of the gateway connecting to the gRPC server itself
+func WithClientConfig(cfg serverGRPC.ClientConfig) OptionFunc {
+	return func(s *Option) { s.clientConfig = cfg }
+}
+
 func WithHTTP(httpServer *http.Server, registerHTTP RegisterHTTP) OptionFunc {
 	return func(s *Option) {
 		s.httpServer = httpServer
@@ -66,6 +80,10 @@ func NewCMUX(endpoint string, registers []serverGRPC.Register, opts ...OptionFun
 }
 
 func (s *CMUXServer) Start() (err error) {
+	if mode := s.serverConfig.TLSMode; mode != "" && mode != servicer.TLSModePlain {
+		return errors.New("cmux does not support TLS")
+	}
+
 	listener, err := net.Listen("tcp", s.endpoint)
 	if err != nil {
 		return
@@ -79,7 +97,13 @@ func (s *CMUXServer) Start() (err error) {
 }
 
 func (s *CMUXServer) startGRPC() {
-	grpcServer := grpc.NewServer(serverGRPC.NewServerOption(serverGRPC.ServerOptionLogger(s.logger))...)
+	serverOptions, err := serverGRPC.NewServerOption(
+		serverGRPC.ServerOptionLogger(s.logger),
+		serverGRPC.ServerOptionConfig(s.serverConfig))
+	if err != nil {
+		panic(err)
+	}
+	grpcServer := grpc.NewServer(serverOptions...)
 
 	for _, r := range s.registers {
 		if r.RegisterGRPC == nil {
@@ -111,7 +135,11 @@ func (s *CMUXServer) startHTTP() (err error) {
 		panic("httpServer is nil")
 	}
 
-	grpcConn, err := grpc.DialContext(s.ctx, s.endpoint, serverGRPC.NewDialOption()...)
+	dialOptions, err := serverGRPC.NewDialOption(serverGRPC.DialOptionConfig(s.clientConfig))
+	if err != nil {
+		return
+	}
+	grpcConn, err := grpc.DialContext(s.ctx, s.endpoint, dialOptions...)
 	if err != nil {
 		return
 	}
@@ -0,0 +1,171 @@
+package grpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"google.golang.org/grpc/keepalive"
+
+	"github.com/why444216978/gin-api/library/servicer"
+)
+
+// Config is the config of gRPC server and client, it is read from grpc.toml
+type Config struct {
+	Server ServerConfig
+	Client ClientConfig
+}
+
+// ServerConfig is the config of gRPC server, zero value uses the default
+type ServerConfig struct {
+	// MaxConnectionIdleSecond sends GOAWAY when the connection is idle for it, default 15
+	MaxConnectionIdleSecond int `validate:"min=0"`
+	// MaxConnectionAgeSecond sends GOAWAY when the connection is alive for it, default 30
+	MaxConnectionAgeSecond int `validate:"min=0"`
+	// MaxConnectionAgeGraceSecond is the time for pending RPCs to complete after MaxConnectionAge, default 5
+	MaxConnectionAgeGraceSecond int `validate:"min=0"`
+	// KeepaliveTimeSecond pings the client when it is idle for it, default 5
+	KeepaliveTimeSecond int `validate:"min=0"`
+	// KeepaliveTimeoutSecond is the timeout of ping ack, default 1
+	KeepaliveTimeoutSecond int `validate:"min=0"`
+	// KeepaliveMinTimeSecond terminates the connection when client pings more often than it, default 5
+	KeepaliveMinTimeSecond int `validate:"min=0"`
+	// MaxRecvMsgSize and MaxSendMsgSize are the max message bytes, zero is the default of gRPC
+	MaxRecvMsgSize int `validate:"min=0"`
+	MaxSendMsgSize int `validate:"min=0"`
+	// TLSMode is one of plain、tls、mtls, empty is plain, mtls requires and verifies client certificate by ClientCaFile
+	TLSMode      string `validate:"omitempty,oneof=plain tls mtls"`
+	CertFile     string
+	KeyFile      string
+	ClientCaFile string
+}
+
+// ClientConfig is the config of gRPC client, zero value uses the default
+type ClientConfig struct {
+	// KeepaliveTimeSecond pings the server when there is no activity for it, default 10
+	KeepaliveTimeSecond int `validate:"min=0"`
+	// KeepaliveTimeoutSecond is the timeout of ping ack, default 1
+	KeepaliveTimeoutSecond int `validate:"min=0"`
+	// MaxRecvMsgSize and MaxSendMsgSize are the max message bytes, zero is the default of gRPC
+	MaxRecvMsgSize int `validate:"min=0"`
+	MaxSendMsgSize int `validate:"min=0"`
+	// Compressor compresses the request messages, only gzip is supported, empty is disabled
+	Compressor string `validate:"omitempty,oneof=gzip"`
+	// TLSMode is one of plain、tls、mtls、insecure, empty is plain
+	TLSMode       string `validate:"omitempty,oneof=plain tls mtls insecure"`
+	TLSServerName string
+	CaCrtFile     string
+	ClientPemFile string
+	ClientKeyFile string
+}
+
+func (c ServerConfig) keepaliveParams() keepalive.ServerParameters {
+	return keepalive.ServerParameters{
+		MaxConnectionIdle:     second(c.MaxConnectionIdleSecond, 15),
+		MaxConnectionAge:      second(c.MaxConnectionAgeSecond, 30),
+		MaxConnectionAgeGrace: second(c.MaxConnectionAgeGraceSecond, 5),
+		Time:                  second(c.KeepaliveTimeSecond, 5),
+		Timeout:               second(c.KeepaliveTimeoutSecond, 1),
+	}
+}
+
+func (c ServerConfig) enforcementPolicy() keepalive.EnforcementPolicy {
+	return keepalive.EnforcementPolicy{
+		MinTime:             second(c.KeepaliveMinTimeSecond, 5),
+		PermitWithoutStream: true,
+	}
+}
+
+// TLSConfig returns the tls.Config of TLSMode, nil is returned when plain
+func (c ServerConfig) TLSConfig() (*tls.Config, error) {
+	switch c.TLSMode {
+	case "", servicer.TLSModePlain:
+		return nil, nil
+	case servicer.TLSModeTLS, servicer.TLSModeMTLS:
+	default:
+		return nil, fmt.Errorf("unknown TLSMode %s", c.TLSMode)
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if c.TLSMode == servicer.TLSModeTLS {
+		return cfg, nil
+	}
+
+	pool, err := loadCertPool(c.ClientCaFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+
+	return cfg, nil
+}
+
+func (c ClientConfig) keepaliveParams() keepalive.ClientParameters {
+	return keepalive.ClientParameters{
+		Time:                second(c.KeepaliveTimeSecond, 10),
+		Timeout:             second(c.KeepaliveTimeoutSecond, 1),
+		PermitWithoutStream: true,
+	}
+}
+
+// TLSConfig returns the tls.Config of TLSMode, nil is returned when plain
+func (c ClientConfig) TLSConfig() (*tls.Config, error) {
+	switch c.TLSMode {
+	case "", servicer.TLSModePlain:
+		return nil, nil
+	case servicer.TLSModeInsecure:
+		return &tls.Config{InsecureSkipVerify: true}, nil
+	case servicer.TLSModeTLS, servicer.TLSModeMTLS:
+	default:
+		return nil, fmt.Errorf("unknown TLSMode %s", c.TLSMode)
+	}
+
+	cfg := &tls.Config{ServerName: c.TLSServerName}
+	// CaCrtFile为空时使用系统根证书
+	if c.CaCrtFile != "" {
+		pool, err := loadCertPool(c.CaCrtFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if c.TLSMode == servicer.TLSModeTLS {
+		return cfg, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.ClientPemFile, c.ClientKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Certificates = []tls.Certificate{cert}
+
+	return cfg, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, errors.New("no certificate in " + file)
+	}
+	return pool, nil
+}
+
+// second returns seconds of v, def is used when v is not positive
+func second(v, def int) time.Duration {
+	if v <= 0 {
+		v = def
+	}
+	return time.Duration(v) * time.Second
+}
@@ -0,0 +1,154 @@
+package grpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/why444216978/gin-api/library/servicer"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// writeTestCert writes the certificate signed by parent and its key to dir, parent nil is self-signed CA
+func writeTestCert(t *testing.T, dir, cn string, parent *testCert) (*testCert, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		DNSNames:              []string{cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  parent == nil,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	parentCert, parentKey := tpl, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, parentCert, &key.PublicKey, parentKey)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	certFile := filepath.Join(dir, cn+".crt")
+	keyFile := filepath.Join(dir, cn+".key")
+	assert.Nil(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.Nil(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	return &testCert{cert: cert, key: key}, certFile, keyFile
+}
+
+func TestConfig(t *testing.T) {
+	convey.Convey("TestConfig", t, func() {
+		convey.Convey("keepalive default", func() {
+			assert.Equal(t, 30*time.Second, ServerConfig{}.keepaliveParams().MaxConnectionAge)
+			assert.Equal(t, 60*time.Second, ServerConfig{MaxConnectionAgeSecond: 60}.keepaliveParams().MaxConnectionAge)
+			assert.Equal(t, 5*time.Second, ServerConfig{}.enforcementPolicy().MinTime)
+			assert.Equal(t, 10*time.Second, ClientConfig{}.keepaliveParams().Time)
+		})
+		convey.Convey("invalid", func() {
+			_, err := NewServerOption(ServerOptionConfig(ServerConfig{TLSMode: "unknown"}))
+			assert.NotNil(t, err)
+			_, err = NewServerOption(ServerOptionConfig(ServerConfig{TLSMode: servicer.TLSModeTLS, CertFile: "not_exist"}))
+			assert.NotNil(t, err)
+			_, err = NewDialOption(DialOptionConfig(ClientConfig{Compressor: "snappy"}))
+			assert.NotNil(t, err)
+			_, err = NewDialOption(DialOptionConfig(ClientConfig{TLSMode: servicer.TLSModeMTLS, CaCrtFile: "not_exist"}))
+			assert.NotNil(t, err)
+		})
+		convey.Convey("mtls and gzip", func() {
+			dir, err := ioutil.TempDir("", "grpc_tls")
+			assert.Nil(t, err)
+			defer os.RemoveAll(dir)
+
+			ca, caFile, _ := writeTestCert(t, dir, "test_ca", nil)
+			_, serverCert, serverKey := writeTestCert(t, dir, "test_server", ca)
+			_, clientCert, clientKey := writeTestCert(t, dir, "test_client", ca)
+
+			var interceptorCalled bool
+			serverOptions, err := NewServerOption(
+				ServerOptionConfig(ServerConfig{
+					TLSMode:        servicer.TLSModeMTLS,
+					CertFile:       serverCert,
+					KeyFile:        serverKey,
+					ClientCaFile:   caFile,
+					MaxRecvMsgSize: 1024,
+				}),
+				ServerOptionUnaryInterceptors(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+					interceptorCalled = true
+					return handler(ctx, req)
+				}),
+			)
+			assert.Nil(t, err)
+
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.Nil(t, err)
+			s := grpc.NewServer(serverOptions...)
+			healthpb.RegisterHealthServer(s, health.NewServer())
+			go func() { _ = s.Serve(lis) }()
+			defer s.Stop()
+
+			check := func(cfg ClientConfig, service string) error {
+				dialOptions, err := NewDialOption(DialOptionConfig(cfg))
+				assert.Nil(t, err)
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+				defer cancel()
+				cc, err := grpc.DialContext(ctx, lis.Addr().String(), dialOptions...)
+				assert.Nil(t, err)
+				defer cc.Close()
+
+				_, err = healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+				return err
+			}
+
+			mtls := ClientConfig{
+				TLSMode:       servicer.TLSModeMTLS,
+				TLSServerName: "test_server",
+				CaCrtFile:     caFile,
+				ClientPemFile: clientCert,
+				ClientKeyFile: clientKey,
+				Compressor:    "gzip",
+			}
+			assert.Nil(t, check(mtls, ""))
+			assert.Equal(t, true, interceptorCalled)
+
+			// message larger than MaxRecvMsgSize of server
+			assert.NotNil(t, check(mtls, string(make([]byte, 2048))))
+
+			// client certificate is required
+			tls := mtls
+			tls.TLSMode = servicer.TLSModeTLS
+			assert.NotNil(t, check(tls, ""))
+
+			assert.NotNil(t, check(ClientConfig{}, ""))
+		})
+	})
+}
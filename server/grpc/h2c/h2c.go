@@ -18,7 +18,9 @@ import (
 )
 
 type Option struct {
-	logger logger.Logger
+	logger       logger.Logger
+	serverConfig serverGRPC.ServerConfig
+	clientConfig serverGRPC.ClientConfig
 }
 
 type OptionFunc func(*Option)
@@ -27,6 +29,17 @@ func WithLogger(l logger.Logger) OptionFunc {
 	return func(s *Option) { s.logger = l }
 }
 
+// WithServerConfig sets the config of gRPC server, the TLS of it is served by the HTTP server
+func WithServerConfig(cfg serverGRPC.ServerConfig) OptionFunc {
+	return func(s *Option) { s.serverConfig = cfg }
+}
+
+// WithClientConfig sets the config of the gateway connecting to the gRPC server itself,
+// it must trust the server certificate when TLS is enabled
+func WithClientConfig(cfg serverGRPC.ClientConfig) OptionFunc {
+	return func(s *Option) { s.clientConfig = cfg }
+}
+
 type H2CServer struct {
 	*Option
 	*grpc.Server
@@ -59,7 +72,22 @@ func NewH2C(endpoint string, registers []serverGRPC.Register, opts ...OptionFunc
 }
 
 func (s *H2CServer) Start() (err error) {
-	grpcServer := grpc.NewServer(serverGRPC.NewServerOption(serverGRPC.ServerOptionLogger(s.logger))...)
+	serverOptions, err := serverGRPC.NewServerOption(
+		serverGRPC.ServerOptionLogger(s.logger),
+		serverGRPC.ServerOptionConfig(s.serverConfig))
+	if err != nil {
+		return
+	}
+	dialOptions, err := serverGRPC.NewDialOption(serverGRPC.DialOptionConfig(s.clientConfig))
+	if err != nil {
+		return
+	}
+	tlsConfig, err := s.serverConfig.TLSConfig()
+	if err != nil {
+		return
+	}
+
+	grpcServer := grpc.NewServer(serverOptions...)
 
 	mux := http.NewServeMux()
 	gwmux := runtime.NewServeMux()
@@ -71,7 +99,7 @@ func (s *H2CServer) Start() (err error) {
 		}
 
 		r.RegisterGRPC(grpcServer)
-		if err = r.RegisterMux(s.ctx, gwmux, s.endpoint, serverGRPC.NewDialOption()); err != nil {
+		if err = r.RegisterMux(s.ctx, gwmux, s.endpoint, dialOptions); err != nil {
 			return
 		}
 	}
@@ -91,6 +119,12 @@ func (s *H2CServer) Start() (err error) {
 		}), &http2.Server{}),
 	}
 
+	// grpc.Server.ServeHTTP不使用grpc的TLS凭证，由HTTP server负责TLS
+	if tlsConfig != nil {
+		s.httpServer.TLSConfig = tlsConfig
+		return s.httpServer.ListenAndServeTLS("", "")
+	}
+
 	return s.httpServer.ListenAndServe()
 }
 
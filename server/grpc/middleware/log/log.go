@@ -5,12 +5,20 @@ import (
 	"net"
 	"time"
 
+	"github.com/opentracing/opentracing-go"
+	"github.com/why444216978/go-util/assert"
 	"github.com/why444216978/go-util/snowflake"
+	"github.com/why444216978/go-util/sys"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 
+	"github.com/why444216978/gin-api/library/app"
+	"github.com/why444216978/gin-api/library/jaeger"
 	"github.com/why444216978/gin-api/library/logger"
+	timeoutLib "github.com/why444216978/gin-api/server/http/middleware/timeout"
 )
 
 func LogIDFromMD(md metadata.MD) string {
@@ -34,30 +42,26 @@ func GetPeerAddr(ctx context.Context) string {
 	return addr
 }
 
+// UnaryServerInterceptor injects log id and trace id into ctx before the handler, and logs every call if l is not nil
 func UnaryServerInterceptor(l logger.Logger) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
 		start := time.Now()
-		resp, err = handler(ctx, req)
-		if l == nil {
-			return
-		}
 
-		md, has := metadata.FromIncomingContext(ctx)
-		if !has {
-			md = metadata.MD{}
-		}
-		logID := LogIDFromMD(md)
-
-		grpc.SetTrailer(ctx, metadata.MD{
+		ctx, logID := incomingContext(ctx, info.FullMethod, req)
+		_ = grpc.SetTrailer(ctx, metadata.MD{
 			logger.LogID: []string{logID},
 		})
 
-		// TODO full fields
-		fields := []logger.Field{
-			logger.Reflect(logger.LogID, logID),
-			logger.Reflect(logger.Cost, time.Since(start).Milliseconds()),
+		resp, err = handler(ctx, req)
+		if assert.IsNil(l) {
+			return
 		}
-		ctx = logger.WithFields(ctx, fields)
+
+		ctx = logger.AddField(ctx,
+			logger.Reflect(logger.Response, resp),
+			logger.Reflect(logger.Code, int(status.Code(err))),
+			logger.Reflect(logger.Cost, time.Since(start).Milliseconds()),
+		)
 		if err != nil {
 			l.Error(ctx, "grpc err", logger.Error(err))
 		} else {
@@ -68,9 +72,128 @@ func UnaryServerInterceptor(l logger.Logger) grpc.UnaryServerInterceptor {
 	}
 }
 
-func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+// incomingContext injects log id, trace id and the common log fields into ctx, the log id is generated if absent
+func incomingContext(ctx context.Context, method string, req interface{}) (context.Context, string) {
+	md, has := metadata.FromIncomingContext(ctx)
+	if !has {
+		md = metadata.MD{}
+	}
+	logID := LogIDFromMD(md)
+	ctx = logger.WithLogID(ctx, logID)
+
+	var traceID string
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		traceID = jaeger.GetTraceID(span)
+	}
+	ctx = logger.WithTraceID(ctx, traceID)
+
+	clientIP := GetPeerAddr(ctx)
+	var clientPort int
+	if pr, ok := peer.FromContext(ctx); ok {
+		_, clientPort = peerAddr(pr)
+	}
+	serverIP, _ := sys.LocalIP()
+
+	fields := []logger.Field{
+		logger.Reflect(logger.LogID, logID),
+		logger.Reflect(logger.TraceID, traceID),
+		logger.Reflect(logger.Header, md),
+		logger.Reflect(logger.Method, method),
+		logger.Reflect(logger.Request, req),
+		logger.Reflect(logger.Response, make(map[string]interface{})),
+		logger.Reflect(logger.ClientIP, clientIP),
+		logger.Reflect(logger.ClientPort, clientPort),
+		logger.Reflect(logger.ServerIP, serverIP),
+		logger.Reflect(logger.ServerPort, app.Port()),
+		logger.Reflect(logger.API, method),
+	}
+	// handler之前写入ctx，handler内可获取log id及trace
+	ctx = logger.WithFields(ctx, fields)
+
+	return ctx, logID
+}
+
+// UnaryClientInterceptor propagates log id and the remaining timeout to the server, and logs every call if l is not nil
+func UnaryClientInterceptor(l logger.Logger) grpc.UnaryClientInterceptor {
 	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) (err error) {
-		// TODO
-		return invoker(ctx, method, req, reply, cc, opts...)
+		var (
+			start   = time.Now()
+			pr      = &peer.Peer{}
+			timeout time.Duration
+		)
+
+		defer func() {
+			if assert.IsNil(l) {
+				return
+			}
+			ip, port := peerAddr(pr)
+			fields := []logger.Field{
+				logger.Reflect(logger.ServiceName, cc.Target()),
+				logger.Reflect(logger.Method, method),
+				logger.Reflect(logger.API, method),
+				logger.Reflect(logger.Request, req),
+				logger.Reflect(logger.Response, reply),
+				logger.Reflect(logger.ServerIP, ip),
+				logger.Reflect(logger.ServerPort, port),
+				logger.Reflect(logger.Code, int(status.Code(err))),
+				logger.Reflect(logger.Cost, time.Since(start).Milliseconds()),
+				logger.Reflect(logger.Timeout, timeout),
+			}
+			if err == nil {
+				l.Info(ctx, "grpc success", fields...)
+				return
+			}
+			l.Error(ctx, err.Error(), fields...)
+		}()
+
+		var cancel context.CancelFunc
+		ctx, cancel, timeout, err = outgoingContext(ctx)
+		if err != nil {
+			return
+		}
+		defer cancel()
+
+		opts = append(opts, grpc.Peer(pr))
+		err = invoker(ctx, method, req, reply, cc, opts...)
+
+		return
+	}
+}
+
+// outgoingContext propagates log id and the remaining timeout by ctx, cancel must be called when the call finishes
+func outgoingContext(ctx context.Context) (context.Context, context.CancelFunc, time.Duration, error) {
+	var (
+		cancel  context.CancelFunc = func() {}
+		timeout time.Duration
+	)
+
+	// 超时传递，上游传递的剩余超时转为deadline，由grpc-timeout传递给下游
+	remain, err := timeoutLib.CalcRemainTimeout(ctx)
+	if err != nil {
+		return ctx, cancel, timeout, status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	if remain > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(remain)*time.Millisecond)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+
+	// log id传递
+	if logID := logger.ValueLogID(ctx); logID != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, logger.LogID, logID)
+	}
+
+	return ctx, cancel, timeout, nil
+}
+
+// peerAddr returns the ip and port of peer
+func peerAddr(pr *peer.Peer) (string, int) {
+	if pr.Addr == nil {
+		return "", 0
+	}
+	if tcpAddr, ok := pr.Addr.(*net.TCPAddr); ok {
+		return tcpAddr.IP.String(), tcpAddr.Port
 	}
+	return pr.Addr.String(), 0
 }
@@ -0,0 +1,177 @@
+package log
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/why444216978/gin-api/library/logger"
+	timeoutLib "github.com/why444216978/gin-api/server/http/middleware/timeout"
+)
+
+type recordLogger struct {
+	lock   sync.Mutex
+	level  string
+	msg    string
+	ctx    context.Context
+	fields map[string]interface{}
+}
+
+var _ logger.Logger = (*recordLogger)(nil)
+
+func (l *recordLogger) record(ctx context.Context, level, msg string, fields ...logger.Field) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.ctx, l.level, l.msg = ctx, level, msg
+	l.fields = map[string]interface{}{}
+	for _, f := range fields {
+		l.fields[f.Key()] = f.Value()
+	}
+}
+
+func (l *recordLogger) Debug(ctx context.Context, msg string, fields ...logger.Field) {
+	l.record(ctx, "debug", msg, fields...)
+}
+
+func (l *recordLogger) Info(ctx context.Context, msg string, fields ...logger.Field) {
+	l.record(ctx, "info", msg, fields...)
+}
+
+func (l *recordLogger) Warn(ctx context.Context, msg string, fields ...logger.Field) {
+	l.record(ctx, "warn", msg, fields...)
+}
+
+func (l *recordLogger) Error(ctx context.Context, msg string, fields ...logger.Field) {
+	l.record(ctx, "error", msg, fields...)
+}
+
+func (l *recordLogger) Fatal(ctx context.Context, msg string, fields ...logger.Field) {
+	l.record(ctx, "fatal", msg, fields...)
+}
+
+func (l *recordLogger) GetLevel() logger.Level { return logger.DebugLevel }
+
+func (l *recordLogger) Close() error { return nil }
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	convey.Convey("TestUnaryClientInterceptor", t, func() {
+		cc, err := grpc.Dial("127.0.0.1:1", grpc.WithInsecure())
+		assert.Nil(t, err)
+		defer cc.Close()
+
+		convey.Convey("propagate log id and timeout", func() {
+			l := &recordLogger{}
+			ctx := logger.WithLogID(context.Background(), "log_id_test")
+			ctx = timeoutLib.SetStart(ctx, 1000)
+
+			invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				md, _ := metadata.FromOutgoingContext(ctx)
+				assert.Equal(t, []string{"log_id_test"}, md.Get(logger.LogID))
+
+				deadline, ok := ctx.Deadline()
+				assert.Equal(t, true, ok)
+				assert.LessOrEqual(t, time.Until(deadline), time.Second)
+				return nil
+			}
+			err := UnaryClientInterceptor(l)(ctx, "/test.Test/Test", "req", "reply", cc, invoker)
+			assert.Nil(t, err)
+			assert.Equal(t, "info", l.level)
+			assert.Equal(t, "/test.Test/Test", l.fields[logger.Method])
+			assert.Equal(t, "req", l.fields[logger.Request])
+			assert.Equal(t, "reply", l.fields[logger.Response])
+			assert.Equal(t, int(codes.OK), l.fields[logger.Code])
+		})
+		convey.Convey("upstream timeout exceeded", func() {
+			ctx := timeoutLib.SetStart(context.Background(), -1)
+			called := false
+			invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				called = true
+				return nil
+			}
+			err := UnaryClientInterceptor(nil)(ctx, "/test.Test/Test", nil, nil, cc, invoker)
+			assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+			assert.Equal(t, false, called)
+		})
+		convey.Convey("error logged with code", func() {
+			l := &recordLogger{}
+			invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				return status.Error(codes.NotFound, "not found")
+			}
+			err := UnaryClientInterceptor(l)(context.Background(), "/test.Test/Test", nil, nil, cc, invoker)
+			assert.Equal(t, codes.NotFound, status.Code(err))
+			assert.Equal(t, "error", l.level)
+			assert.Equal(t, int(codes.NotFound), l.fields[logger.Code])
+		})
+	})
+}
+
+func TestPeerAddr(t *testing.T) {
+	convey.Convey("TestPeerAddr", t, func() {
+		convey.Convey("tcp", func() {
+			ip, port := peerAddr(&peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 80}})
+			assert.Equal(t, "127.0.0.1", ip)
+			assert.Equal(t, 80, port)
+		})
+		convey.Convey("nil", func() {
+			ip, port := peerAddr(&peer.Peer{})
+			assert.Equal(t, "", ip)
+			assert.Equal(t, 0, port)
+		})
+	})
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	convey.Convey("TestUnaryServerInterceptor", t, func() {
+		convey.Convey("log id injected before handler", func() {
+			l := &recordLogger{}
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(logger.LogID, "log_id_test"))
+			ctx = peer.NewContext(ctx, &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("127.0.0.2"), Port: 8080}})
+
+			var handlerLogID string
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				handlerLogID = logger.ValueLogID(ctx)
+				return "resp", nil
+			}
+			info := &grpc.UnaryServerInfo{FullMethod: "/test.Test/Test"}
+			resp, err := UnaryServerInterceptor(l)(ctx, "req", info, handler)
+			assert.Nil(t, err)
+			assert.Equal(t, "resp", resp)
+			assert.Equal(t, "log_id_test", handlerLogID)
+
+			values := map[string]interface{}{}
+			for _, f := range logger.ValueFields(l.ctx) {
+				values[f.Key()] = f.Value()
+			}
+			assert.Equal(t, "info", l.level)
+			assert.Equal(t, "log_id_test", values[logger.LogID])
+			assert.Equal(t, "/test.Test/Test", values[logger.Method])
+			assert.Equal(t, "req", values[logger.Request])
+			assert.Equal(t, "resp", values[logger.Response])
+			assert.Equal(t, "127.0.0.2", values[logger.ClientIP])
+			assert.Equal(t, 8080, values[logger.ClientPort])
+			assert.Equal(t, int(codes.OK), values[logger.Code])
+		})
+		convey.Convey("log id generated", func() {
+			var handlerLogID string
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				handlerLogID = logger.ValueLogID(ctx)
+				return nil, status.Error(codes.NotFound, "not found")
+			}
+			l := &recordLogger{}
+			_, err := UnaryServerInterceptor(l)(context.Background(), nil, &grpc.UnaryServerInfo{}, handler)
+			assert.Equal(t, codes.NotFound, status.Code(err))
+			assert.NotEmpty(t, handlerLogID)
+			assert.Equal(t, "error", l.level)
+		})
+	})
+}
@@ -0,0 +1,206 @@
+package log
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/why444216978/go-util/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/why444216978/gin-api/library/logger"
+)
+
+const (
+	fieldSendMsgs = "send_msgs"
+	fieldRecvMsgs = "recv_msgs"
+)
+
+// serverStream counts the messages of stream, and carries the ctx injected log id
+type serverStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	sendMsgs int64
+	recvMsgs int64
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		atomic.AddInt64(&s.sendMsgs, 1)
+	}
+	return err
+}
+
+func (s *serverStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		atomic.AddInt64(&s.recvMsgs, 1)
+	}
+	return err
+}
+
+// StreamServerInterceptor injects log id and trace id into the stream ctx before the handler,
+// and logs every stream with the message counts and duration if l is not nil.
+func StreamServerInterceptor(l logger.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		start := time.Now()
+
+		ctx, logID := incomingContext(ss.Context(), info.FullMethod, nil)
+		ss.SetTrailer(metadata.MD{
+			logger.LogID: []string{logID},
+		})
+
+		stream := &serverStream{ServerStream: ss, ctx: ctx}
+		err = handler(srv, stream)
+		if assert.IsNil(l) {
+			return
+		}
+
+		ctx = logger.AddField(ctx,
+			logger.Reflect(logger.Code, int(status.Code(err))),
+			logger.Reflect(logger.Cost, time.Since(start).Milliseconds()),
+			logger.Reflect(fieldSendMsgs, atomic.LoadInt64(&stream.sendMsgs)),
+			logger.Reflect(fieldRecvMsgs, atomic.LoadInt64(&stream.recvMsgs)),
+		)
+		if err != nil {
+			l.Error(ctx, "grpc stream err", logger.Error(err))
+		} else {
+			l.Info(ctx, "grpc stream info")
+		}
+
+		return
+	}
+}
+
+// clientStream counts the messages of stream and calls finish once when the stream ends
+type clientStream struct {
+	grpc.ClientStream
+	desc     *grpc.StreamDesc
+	sendMsgs int64
+	recvMsgs int64
+	once     sync.Once
+	finished chan struct{}
+	finish   func(sendMsgs, recvMsgs int64, err error)
+}
+
+func newClientStream(ctx context.Context, cs grpc.ClientStream, desc *grpc.StreamDesc, finish func(sendMsgs, recvMsgs int64, err error)) *clientStream {
+	s := &clientStream{
+		ClientStream: cs,
+		desc:         desc,
+		finished:     make(chan struct{}),
+		finish:       finish,
+	}
+	// 调用方放弃流或超时时同样结束，避免漏记日志和泄漏cancel
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.done(status.FromContextError(ctx.Err()).Err())
+		case <-s.finished:
+		}
+	}()
+	return s
+}
+
+func (s *clientStream) SendMsg(m interface{}) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		atomic.AddInt64(&s.sendMsgs, 1)
+		return nil
+	}
+	// io.EOF表示流已结束，真实错误由RecvMsg返回
+	if err != io.EOF {
+		s.done(err)
+	}
+	return err
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil {
+		atomic.AddInt64(&s.recvMsgs, 1)
+		// 非服务端流只有一个响应，CloseAndRecv不会再读到io.EOF
+		if !s.desc.ServerStreams {
+			s.done(nil)
+		}
+		return nil
+	}
+	if err == io.EOF {
+		s.done(nil)
+	} else {
+		s.done(err)
+	}
+	return err
+}
+
+func (s *clientStream) done(err error) {
+	s.once.Do(func() {
+		s.finish(atomic.LoadInt64(&s.sendMsgs), atomic.LoadInt64(&s.recvMsgs), err)
+		close(s.finished)
+	})
+}
+
+// StreamClientInterceptor propagates log id and the remaining timeout to the server,
+// and logs every stream with the message counts and duration when it ends if l is not nil.
+func StreamClientInterceptor(l logger.Logger) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (cs grpc.ClientStream, err error) {
+		var (
+			start   = time.Now()
+			pr      = &peer.Peer{}
+			timeout time.Duration
+			cancel  context.CancelFunc = func() {}
+		)
+
+		finish := func(sendMsgs, recvMsgs int64, err error) {
+			cancel()
+			if assert.IsNil(l) {
+				return
+			}
+			ip, port := peerAddr(pr)
+			fields := []logger.Field{
+				logger.Reflect(logger.ServiceName, cc.Target()),
+				logger.Reflect(logger.Method, method),
+				logger.Reflect(logger.API, method),
+				logger.Reflect(logger.ServerIP, ip),
+				logger.Reflect(logger.ServerPort, port),
+				logger.Reflect(logger.Code, int(status.Code(err))),
+				logger.Reflect(logger.Cost, time.Since(start).Milliseconds()),
+				logger.Reflect(logger.Timeout, timeout),
+				logger.Reflect(fieldSendMsgs, sendMsgs),
+				logger.Reflect(fieldRecvMsgs, recvMsgs),
+			}
+			if err == nil {
+				l.Info(ctx, "grpc stream success", fields...)
+				return
+			}
+			l.Error(ctx, err.Error(), fields...)
+		}
+
+		streamCtx, cancel, timeout, err := outgoingContext(ctx)
+		if err != nil {
+			finish(0, 0, err)
+			return
+		}
+
+		cs, err = streamer(streamCtx, desc, cc, method, opts...)
+		if err != nil {
+			finish(0, 0, err)
+			return
+		}
+		// 不使用grpc.Peer，其在流结束时写入，与ctx结束时的finish存在竞争
+		if p, ok := peer.FromContext(cs.Context()); ok {
+			pr = p
+		}
+
+		return newClientStream(streamCtx, cs, desc, finish), nil
+	}
+}
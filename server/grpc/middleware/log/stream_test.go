@@ -0,0 +1,180 @@
+package log
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/why444216978/gin-api/library/logger"
+)
+
+const (
+	streamMethod       = "/test.Stream/Echo"
+	clientStreamMethod = "/test.Stream/Count"
+)
+
+var (
+	streamDesc       = &grpc.StreamDesc{StreamName: "Echo", ServerStreams: true, ClientStreams: true}
+	clientStreamDesc = &grpc.StreamDesc{StreamName: "Count", ClientStreams: true}
+)
+
+// echoHandler replies every request twice, it fails when the service of request is "fail"
+func echoHandler(srv interface{}, stream grpc.ServerStream) error {
+	for {
+		req := &healthpb.HealthCheckRequest{}
+		if err := stream.RecvMsg(req); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if req.Service == "fail" {
+			return status.Error(codes.InvalidArgument, "fail")
+		}
+		for i := 0; i < 2; i++ {
+			if err := stream.SendMsg(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// countHandler replies once after all requests are received
+func countHandler(srv interface{}, stream grpc.ServerStream) error {
+	for {
+		if err := stream.RecvMsg(&healthpb.HealthCheckRequest{}); err == io.EOF {
+			return stream.SendMsg(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING})
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func newStreamServer(t *testing.T, opts ...grpc.ServerOption) (*grpc.Server, string) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	s := grpc.NewServer(opts...)
+	s.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "test.Stream",
+		HandlerType: (*interface{})(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    streamDesc.StreamName,
+			Handler:       echoHandler,
+			ServerStreams: true,
+			ClientStreams: true,
+		}, {
+			StreamName:    clientStreamDesc.StreamName,
+			Handler:       countHandler,
+			ClientStreams: true,
+		}},
+	}, struct{}{})
+	go func() { _ = s.Serve(lis) }()
+
+	return s, lis.Addr().String()
+}
+
+func TestStreamInterceptor(t *testing.T) {
+	convey.Convey("TestStreamInterceptor", t, func() {
+		serverLogger := &recordLogger{}
+		server, addr := newStreamServer(t, grpc.StreamInterceptor(StreamServerInterceptor(serverLogger)))
+		defer server.Stop()
+
+		clientLogger := &recordLogger{}
+		cc, err := grpc.Dial(addr, grpc.WithInsecure(), grpc.WithStreamInterceptor(StreamClientInterceptor(clientLogger)))
+		assert.Nil(t, err)
+		defer cc.Close()
+
+		echo := func(services ...string) error {
+			ctx, cancel := context.WithTimeout(logger.WithLogID(context.Background(), "log_id_test"), time.Second*3)
+			defer cancel()
+
+			stream, err := cc.NewStream(ctx, streamDesc, streamMethod)
+			assert.Nil(t, err)
+			for _, service := range services {
+				assert.Nil(t, stream.SendMsg(&healthpb.HealthCheckRequest{Service: service}))
+			}
+			assert.Nil(t, stream.CloseSend())
+			for {
+				if err := stream.RecvMsg(&healthpb.HealthCheckResponse{}); err == io.EOF {
+					return nil
+				} else if err != nil {
+					return err
+				}
+			}
+		}
+
+		convey.Convey("success", func() {
+			assert.Nil(t, echo("a", "b"))
+
+			assert.Equal(t, "info", clientLogger.level)
+			assert.Equal(t, int64(2), clientLogger.fields[fieldSendMsgs])
+			assert.Equal(t, int64(4), clientLogger.fields[fieldRecvMsgs])
+			assert.Equal(t, int(codes.OK), clientLogger.fields[logger.Code])
+			assert.NotEmpty(t, clientLogger.fields[logger.ServerIP])
+
+			assert.Eventually(t, func() bool {
+				serverLogger.lock.Lock()
+				defer serverLogger.lock.Unlock()
+				return serverLogger.level == "info"
+			}, time.Second, time.Millisecond*10)
+			serverLogger.lock.Lock()
+			defer serverLogger.lock.Unlock()
+			fields := logger.ValueFields(serverLogger.ctx)
+			values := map[string]interface{}{}
+			for _, f := range fields {
+				values[f.Key()] = f.Value()
+			}
+			assert.Equal(t, "log_id_test", values[logger.LogID])
+			assert.Equal(t, int64(4), values[fieldSendMsgs])
+			assert.Equal(t, int64(2), values[fieldRecvMsgs])
+		})
+		convey.Convey("client streaming", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer cancel()
+
+			stream, err := cc.NewStream(ctx, clientStreamDesc, clientStreamMethod)
+			assert.Nil(t, err)
+			assert.Nil(t, stream.SendMsg(&healthpb.HealthCheckRequest{}))
+			assert.Nil(t, stream.SendMsg(&healthpb.HealthCheckRequest{}))
+			// 与生成代码的CloseAndRecv一致，只读取一次
+			assert.Nil(t, stream.CloseSend())
+			assert.Nil(t, stream.RecvMsg(&healthpb.HealthCheckResponse{}))
+
+			clientLogger.lock.Lock()
+			defer clientLogger.lock.Unlock()
+			assert.Equal(t, "info", clientLogger.level)
+			assert.Equal(t, clientStreamMethod, clientLogger.fields[logger.Method])
+			assert.Equal(t, int64(2), clientLogger.fields[fieldSendMsgs])
+			assert.Equal(t, int64(1), clientLogger.fields[fieldRecvMsgs])
+		})
+		convey.Convey("abandoned", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			_, err := cc.NewStream(ctx, streamDesc, streamMethod)
+			assert.Nil(t, err)
+			cancel()
+
+			assert.Eventually(t, func() bool {
+				clientLogger.lock.Lock()
+				defer clientLogger.lock.Unlock()
+				return clientLogger.level == "error" && clientLogger.fields[logger.Code] == int(codes.Canceled)
+			}, time.Second, time.Millisecond*10)
+		})
+		convey.Convey("error", func() {
+			err := echo("a", "fail")
+			assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+			assert.Equal(t, "error", clientLogger.level)
+			assert.Equal(t, int(codes.InvalidArgument), clientLogger.fields[logger.Code])
+			assert.Equal(t, int64(2), clientLogger.fields[fieldRecvMsgs])
+		})
+	})
+}
@@ -12,69 +12,131 @@ import (
 	opentracingLog "github.com/opentracing/opentracing-go/log"
 	"github.com/pkg/errors"
 	"github.com/why444216978/go-util/assert"
+	"github.com/why444216978/go-util/validate"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	_ "google.golang.org/grpc/encoding/gzip" // register gzip compressor
 	"google.golang.org/grpc/status"
 
+	"github.com/why444216978/gin-api/client/grpc/resolver"
 	"github.com/why444216978/gin-api/library/jaeger"
 	"github.com/why444216978/gin-api/library/logger"
 	"github.com/why444216978/gin-api/server/grpc/middleware/log"
 )
 
-var kaep = keepalive.EnforcementPolicy{
-	MinTime:             5 * time.Second, // If a client pings more than once every 5 seconds, terminate the connection
-	PermitWithoutStream: true,            // Allow pings even when there are no active streams
+type DialOption struct {
+	logger             logger.Logger
+	config             ClientConfig
+	unaryInterceptors  []grpc.UnaryClientInterceptor
+	streamInterceptors []grpc.StreamClientInterceptor
 }
 
-var kasp = keepalive.ServerParameters{
-	MaxConnectionIdle:     15 * time.Second, // If a client is idle for 15 seconds, send a GOAWAY
-	MaxConnectionAge:      30 * time.Second, // If any connection is alive for more than 30 seconds, send a GOAWAY
-	MaxConnectionAgeGrace: 5 * time.Second,  // Allow 5 seconds for pending RPCs to complete before forcibly closing connections
-	Time:                  5 * time.Second,  // Ping the client if it is idle for 5 seconds to ensure the connection is still active
-	Timeout:               1 * time.Second,  // Wait 1 second for the ping ack before assuming the connection is dead
+type DialOptionFunc func(*DialOption)
+
+func DialOptionLogger(l logger.Logger) DialOptionFunc {
+	return func(o *DialOption) { o.logger = l }
 }
 
-var kacp = keepalive.ClientParameters{
-	Time:                10 * time.Second, // send pings every 10 seconds if there is no activity
-	Timeout:             time.Second,      // wait 1 second for ping ack before considering the connection dead
-	PermitWithoutStream: true,             // send pings even without active streams
+func DialOptionConfig(cfg ClientConfig) DialOptionFunc {
+	return func(o *DialOption) { o.config = cfg }
 }
 
-type DialOption struct{}
+// DialOptionUnaryInterceptors appends interceptors after the log and tracing interceptors
+func DialOptionUnaryInterceptors(interceptors ...grpc.UnaryClientInterceptor) DialOptionFunc {
+	return func(o *DialOption) { o.unaryInterceptors = append(o.unaryInterceptors, interceptors...) }
+}
 
-type DialOptionFunc func(*DialOption)
+// DialOptionStreamInterceptors appends interceptors after the log and tracing interceptors
+func DialOptionStreamInterceptors(interceptors ...grpc.StreamClientInterceptor) DialOptionFunc {
+	return func(o *DialOption) { o.streamInterceptors = append(o.streamInterceptors, interceptors...) }
+}
+
+func NewDialOption(opts ...DialOptionFunc) ([]grpc.DialOption, error) {
+	opt := &DialOption{}
+	for _, o := range opts {
+		o(opt)
+	}
+
+	cfg := opt.config
+	if err := validate.ValidateCamel(&cfg); err != nil {
+		return nil, err
+	}
+
+	creds := insecure.NewCredentials()
+	tlsConfig, err := cfg.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	var callOptions []grpc.CallOption
+	if cfg.MaxRecvMsgSize > 0 {
+		callOptions = append(callOptions, grpc.MaxCallRecvMsgSize(cfg.MaxRecvMsgSize))
+	}
+	if cfg.MaxSendMsgSize > 0 {
+		callOptions = append(callOptions, grpc.MaxCallSendMsgSize(cfg.MaxSendMsgSize))
+	}
+	if cfg.Compressor != "" {
+		callOptions = append(callOptions, grpc.UseCompressor(cfg.Compressor))
+	}
+
+	unaryInterceptors := append([]grpc.UnaryClientInterceptor{
+		log.UnaryClientInterceptor(opt.logger),
+		otgrpc.OpenTracingClientInterceptor(
+			opentracing.GlobalTracer(),
+			otgrpc.SpanDecorator(func(span opentracing.Span, method string, req, resp interface{}, err error) {
+				if assert.IsNil(span) {
+					return
+				}
+
+				bs, _ := json.Marshal(req)
+				jaeger.SetRequest(span, string(bs))
+
+				if err != nil {
+					span.LogFields(opentracingLog.Error(err))
+				}
+			}),
+		),
+	}, opt.unaryInterceptors...)
+	streamInterceptors := append([]grpc.StreamClientInterceptor{
+		log.StreamClientInterceptor(opt.logger),
+		otgrpc.OpenTracingStreamClientInterceptor(opentracing.GlobalTracer(), otgrpc.SpanDecorator(streamSpanDecorator)),
+	}, opt.streamInterceptors...)
 
-func NewDialOption(opts ...DialOptionFunc) []grpc.DialOption {
 	return []grpc.DialOption{
-		// TODO
-		// grpc.WithResolvers(resolver),
+		grpc.WithResolvers(resolver.NewBuilder()),
 		grpc.WithTimeout(10 * time.Second),
-		grpc.WithInsecure(),
-		grpc.WithKeepaliveParams(kacp),
-		grpc.WithChainUnaryInterceptor(
-			log.UnaryClientInterceptor(),
-			otgrpc.OpenTracingClientInterceptor(
-				opentracing.GlobalTracer(),
-				otgrpc.SpanDecorator(func(span opentracing.Span, method string, req, resp interface{}, err error) {
-					if assert.IsNil(span) {
-						return
-					}
-
-					bs, _ := json.Marshal(req)
-					jaeger.SetRequest(span, string(bs))
-
-					if err != nil {
-						span.LogFields(opentracingLog.Error(err))
-					}
-				}),
-			),
-		),
+		grpc.WithTransportCredentials(creds),
+		grpc.WithKeepaliveParams(cfg.keepaliveParams()),
+		grpc.WithDefaultCallOptions(callOptions...),
+		grpc.WithChainUnaryInterceptor(unaryInterceptors...),
+		grpc.WithChainStreamInterceptor(streamInterceptors...),
+	}, nil
+}
+
+// streamSpanDecorator logs the error of stream, the messages of stream are not recorded
+func streamSpanDecorator(span opentracing.Span, method string, req, resp interface{}, err error) {
+	if assert.IsNil(span) || err == nil {
+		return
 	}
+	span.LogFields(opentracingLog.Error(err))
+}
+
+// recoveryHandler surfaces panic as codes.Internal
+func recoveryHandler(ctx context.Context, p interface{}) (err error) {
+	err = errors.WithStack(fmt.Errorf("%v", p))
+	return status.Errorf(codes.Internal, "%+v", err)
 }
 
 type ServerOption struct {
-	logger logger.Logger
+	logger             logger.Logger
+	config             ServerConfig
+	unaryInterceptors  []grpc.UnaryServerInterceptor
+	streamInterceptors []grpc.StreamServerInterceptor
 }
 
 type ServerOptionFunc func(*ServerOption)
@@ -83,12 +145,31 @@ func ServerOptionLogger(l logger.Logger) ServerOptionFunc {
 	return func(o *ServerOption) { o.logger = l }
 }
 
-func NewServerOption(opts ...ServerOptionFunc) []grpc.ServerOption {
+func ServerOptionConfig(cfg ServerConfig) ServerOptionFunc {
+	return func(o *ServerOption) { o.config = cfg }
+}
+
+// ServerOptionUnaryInterceptors appends interceptors after the tracing, recovery and log interceptors
+func ServerOptionUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) ServerOptionFunc {
+	return func(o *ServerOption) { o.unaryInterceptors = append(o.unaryInterceptors, interceptors...) }
+}
+
+// ServerOptionStreamInterceptors appends interceptors after the tracing, recovery and log interceptors
+func ServerOptionStreamInterceptors(interceptors ...grpc.StreamServerInterceptor) ServerOptionFunc {
+	return func(o *ServerOption) { o.streamInterceptors = append(o.streamInterceptors, interceptors...) }
+}
+
+func NewServerOption(opts ...ServerOptionFunc) ([]grpc.ServerOption, error) {
 	opt := &ServerOption{}
 	for _, o := range opts {
 		o(opt)
 	}
 
+	cfg := opt.config
+	if err := validate.ValidateCamel(&cfg); err != nil {
+		return nil, err
+	}
+
 	interceptors := []grpc.UnaryServerInterceptor{
 		otgrpc.OpenTracingServerInterceptor(
 			opentracing.GlobalTracer(),
@@ -104,21 +185,40 @@ func NewServerOption(opts ...ServerOptionFunc) []grpc.ServerOption {
 					span.LogFields(opentracingLog.Error(err))
 				}
 			})),
-		grpc_recovery.UnaryServerInterceptor(
-			grpc_recovery.WithRecoveryHandlerContext(func(ctx context.Context, p interface{}) (err error) {
-				err = errors.WithStack(fmt.Errorf("%v", p))
-				return status.Errorf(codes.Internal, "%+v", err)
-			})),
+		grpc_recovery.UnaryServerInterceptor(grpc_recovery.WithRecoveryHandlerContext(recoveryHandler)),
+		// 无论是否记录日志，handler都依赖其注入的log id和trace id
+		log.UnaryServerInterceptor(opt.logger),
 	}
-	if !assert.IsNil(opt.logger) {
-		interceptors = append(interceptors, log.UnaryServerInterceptor(opt.logger))
+	streamInterceptors := []grpc.StreamServerInterceptor{
+		otgrpc.OpenTracingStreamServerInterceptor(opentracing.GlobalTracer(), otgrpc.SpanDecorator(streamSpanDecorator)),
+		grpc_recovery.StreamServerInterceptor(grpc_recovery.WithRecoveryHandlerContext(recoveryHandler)),
+		log.StreamServerInterceptor(opt.logger),
 	}
+	interceptors = append(interceptors, opt.unaryInterceptors...)
+	streamInterceptors = append(streamInterceptors, opt.streamInterceptors...)
 
-	return []grpc.ServerOption{
-		grpc.KeepaliveEnforcementPolicy(kaep),
-		grpc.KeepaliveParams(kasp),
+	serverOptions := []grpc.ServerOption{
+		grpc.KeepaliveEnforcementPolicy(cfg.enforcementPolicy()),
+		grpc.KeepaliveParams(cfg.keepaliveParams()),
 		grpc.ChainUnaryInterceptor(interceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
 	}
+	if cfg.MaxRecvMsgSize > 0 {
+		serverOptions = append(serverOptions, grpc.MaxRecvMsgSize(cfg.MaxRecvMsgSize))
+	}
+	if cfg.MaxSendMsgSize > 0 {
+		serverOptions = append(serverOptions, grpc.MaxSendMsgSize(cfg.MaxSendMsgSize))
+	}
+
+	tlsConfig, err := cfg.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		serverOptions = append(serverOptions, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	return serverOptions, nil
 }
 
 type CallOption struct{}
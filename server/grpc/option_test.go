@@ -0,0 +1,96 @@
+package grpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/why444216978/gin-api/library/logger"
+)
+
+func TestNewServerOption(t *testing.T) {
+	convey.Convey("TestNewServerOption", t, func() {
+		convey.Convey("stream panic is surfaced as internal", func() {
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.Nil(t, err)
+
+			serverOptions, err := NewServerOption()
+			assert.Nil(t, err)
+			s := grpc.NewServer(serverOptions...)
+			s.RegisterService(&grpc.ServiceDesc{
+				ServiceName: "test.Stream",
+				HandlerType: (*interface{})(nil),
+				Streams: []grpc.StreamDesc{{
+					StreamName:    "Panic",
+					ServerStreams: true,
+					Handler: func(srv interface{}, stream grpc.ServerStream) error {
+						panic("stream panic")
+					},
+				}},
+			}, struct{}{})
+			go func() { _ = s.Serve(lis) }()
+			defer s.Stop()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer cancel()
+			dialOptions, err := NewDialOption()
+			assert.Nil(t, err)
+			cc, err := grpc.DialContext(ctx, lis.Addr().String(), dialOptions...)
+			assert.Nil(t, err)
+			defer cc.Close()
+
+			stream, err := cc.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, "/test.Stream/Panic")
+			assert.Nil(t, err)
+			assert.Nil(t, stream.SendMsg(&healthpb.HealthCheckRequest{}))
+			assert.Nil(t, stream.CloseSend())
+			err = stream.RecvMsg(&healthpb.HealthCheckResponse{})
+			assert.Equal(t, codes.Internal, status.Code(err))
+		})
+		convey.Convey("log id injected without logger", func() {
+			lis, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.Nil(t, err)
+
+			serverOptions, err := NewServerOption()
+			assert.Nil(t, err)
+			s := grpc.NewServer(serverOptions...)
+			var logID string
+			s.RegisterService(&grpc.ServiceDesc{
+				ServiceName: "test.Stream",
+				HandlerType: (*interface{})(nil),
+				Streams: []grpc.StreamDesc{{
+					StreamName:    "LogID",
+					ServerStreams: true,
+					Handler: func(srv interface{}, stream grpc.ServerStream) error {
+						logID = logger.ValueLogID(stream.Context())
+						return nil
+					},
+				}},
+			}, struct{}{})
+			go func() { _ = s.Serve(lis) }()
+			defer s.Stop()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+			defer cancel()
+			dialOptions, err := NewDialOption()
+			assert.Nil(t, err)
+			cc, err := grpc.DialContext(ctx, lis.Addr().String(), dialOptions...)
+			assert.Nil(t, err)
+			defer cc.Close()
+
+			stream, err := cc.NewStream(logger.WithLogID(ctx, "log_id_test"), &grpc.StreamDesc{ServerStreams: true}, "/test.Stream/LogID")
+			assert.Nil(t, err)
+			assert.Nil(t, stream.CloseSend())
+			assert.Equal(t, io.EOF, stream.RecvMsg(&healthpb.HealthCheckResponse{}))
+			assert.Equal(t, "log_id_test", logID)
+		})
+	})
+}
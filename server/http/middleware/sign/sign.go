@@ -0,0 +1,86 @@
+package sign
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/why444216978/gin-api/library/logger"
+	"github.com/why444216978/gin-api/library/signature"
+	"github.com/why444216978/gin-api/server/http/response"
+)
+
+const defaultSkew = 5 * time.Minute
+
+// KeyFunc returns the secret of the caller key id
+type KeyFunc func(keyID string) ([]byte, bool)
+
+// StaticKeys is KeyFunc of the key id to secret map
+func StaticKeys(keys map[string]string) KeyFunc {
+	return func(keyID string) ([]byte, bool) {
+		secret, ok := keys[keyID]
+		if !ok || secret == "" {
+			return nil, false
+		}
+		return []byte(secret), true
+	}
+}
+
+type options struct {
+	skew     time.Duration
+	unsigned bool
+	logger   logger.Logger
+}
+
+type Option func(*options)
+
+// WithSkew sets the max clock skew between caller and callee, default is 5 minutes
+func WithSkew(skew time.Duration) Option {
+	return func(o *options) { o.skew = skew }
+}
+
+// WithUnsignedPayload accepts the streaming requests whose body is not covered by the signature,
+// the method, path, timestamp and nonce are still verified.
+func WithUnsignedPayload() Option {
+	return func(o *options) { o.unsigned = true }
+}
+
+func WithLogger(l logger.Logger) Option {
+	return func(o *options) { o.logger = l }
+}
+
+// Sign verifies the HMAC signature of request and rejects the replayed nonce,
+// the nonce is kept for twice the skew so that it can't be replayed within the window.
+func Sign(keys KeyFunc, store signature.NonceStore, opts ...Option) gin.HandlerFunc {
+	opt := &options{skew: defaultSkew}
+	for _, o := range opts {
+		o(opt)
+	}
+
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		v, err := signature.VerifyRequest(c.Request, keys, opt.skew)
+		if err == nil && v.UnsignedPayload && !opt.unsigned {
+			err = signature.ErrUnsigned
+		}
+		if err == nil {
+			var ok bool
+			ok, err = store.Add(ctx, v.KeyID+":"+v.Nonce, opt.skew*2)
+			if err == nil && !ok {
+				err = signature.ErrReplay
+			}
+		}
+		if err == nil {
+			c.Next()
+			return
+		}
+
+		if opt.logger != nil {
+			opt.logger.Warn(ctx, "sign verify fail", logger.Error(err))
+		}
+		response.ResponseJSON(c, http.StatusUnauthorized, nil, response.WrapToast(err, http.StatusText(http.StatusUnauthorized)))
+		c.AbortWithStatus(http.StatusUnauthorized)
+	}
+}